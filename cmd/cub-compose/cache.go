@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confighub/cub-compose/pkg/compose"
+	"github.com/confighub/cub-compose/pkg/git"
+)
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and clean up cached repo checkouts",
+		Long: `Remote repos are cached with one working tree per repo and ref, by default under
+~/.cub-compose/repos. Use --cache-dir or CUB_COMPOSE_CACHE_DIR to relocate the cache.`,
+	}
+
+	cmd.AddCommand(newCacheListCmd())
+	cmd.AddCommand(newCachePruneCmd())
+	cmd.AddCommand(newCacheCleanCmd())
+
+	return cmd
+}
+
+func newCacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List cached repo checkouts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheList()
+		},
+	}
+}
+
+func newCachePruneCmd() *cobra.Command {
+	var unreferenced bool
+	var unusedDays int
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached checkouts that are no longer needed",
+		Long: `The prune command removes cached checkouts whose repo and ref are not used by
+the config file (-f). With --unused-days, checkouts not used for that many days
+are removed as well. Use --unreferenced=false to prune by age only.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCachePrune(unreferenced, unusedDays, dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&unreferenced, "unreferenced", true, "Remove checkouts not referenced by the config file")
+	cmd.Flags().IntVar(&unusedDays, "unused-days", 0, "Remove checkouts not used for this many days (0 to disable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be removed without removing anything")
+
+	return cmd
+}
+
+func newCacheCleanCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clean",
+		Short: "Remove all cached checkouts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheClean()
+		},
+	}
+}
+
+func runCacheList() error {
+	manager, err := git.NewManager(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := listCache(manager)
+	if err != nil {
+		return err
+	}
+	compose.Report.SetData(cacheResults(entries))
+	if len(entries) == 0 {
+		compose.Report.Printf("No cached repos in %s\n", manager.CacheDir())
+		return nil
+	}
+
+	w := tabwriter.NewWriter(compose.Report.Writer(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tREF\tCOMMIT\tSIZE\tLAST USED\tPATH")
+	var total int64
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.URL, valueOr(e.Ref, "-"), valueOr(shortCommit(e.Commit), "-"),
+			formatSize(e.Size), e.LastUsed.Local().Format("2006-01-02 15:04"), e.Path)
+		total += e.Size
+	}
+	w.Flush()
+
+	compose.Report.Printf("\n%d cached repos, %s in %s\n", len(entries), formatSize(total), manager.CacheDir())
+	return nil
+}
+
+func runCachePrune(unreferenced bool, unusedDays int, dryRun bool) error {
+	if !unreferenced && unusedDays <= 0 {
+		return fmt.Errorf("nothing to prune: use --unreferenced or --unused-days")
+	}
+
+	manager, err := git.NewManager(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	// Checkouts used by the config, keyed by path
+	referenced := make(map[string]bool)
+	if unreferenced {
+		set, err := parseSetVars(setVars)
+		if err != nil {
+			return err
+		}
+		cfg, err := compose.LoadConfig(configFiles, set)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		for _, repoCfg := range cfg.Configs {
+			if !repoCfg.IsLocal() {
+				referenced[manager.GetRepoPath(repoCfg.Repo, repoCfg.Ref)] = true
+			}
+		}
+	}
+
+	entries, err := listCache(manager)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -unusedDays)
+	removed := []git.CacheEntry{}
+	var freed int64
+	for _, e := range entries {
+		var reason string
+		switch {
+		case unreferenced && !referenced[e.Path]:
+			reason = "not referenced by " + strings.Join(configFiles, ", ")
+		case unusedDays > 0 && e.LastUsed.Before(cutoff):
+			reason = fmt.Sprintf("unused for %d days", int(time.Since(e.LastUsed).Hours()/24))
+		default:
+			continue
+		}
+
+		if !dryRun {
+			if err := manager.RemoveCache(e); err != nil {
+				return err
+			}
+		}
+		name := e.URL
+		if e.Ref != "" {
+			name += "@" + e.Ref
+		}
+		compose.Report.Printf("  - %s (%s, %s)\n", name, formatSize(e.Size), reason)
+		removed = append(removed, e)
+		freed += e.Size
+	}
+
+	compose.Report.SetData(cacheResults(removed))
+	if dryRun {
+		compose.Report.Printf("Would remove %d cached repos (%s)\n", len(removed), formatSize(freed))
+	} else {
+		compose.Report.Printf("Removed %d cached repos (%s)\n", len(removed), formatSize(freed))
+	}
+	return nil
+}
+
+func runCacheClean() error {
+	manager, err := git.NewManager(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := listCache(manager)
+	if err != nil {
+		return err
+	}
+
+	var freed int64
+	for _, e := range entries {
+		if err := manager.RemoveCache(e); err != nil {
+			return err
+		}
+		freed += e.Size
+	}
+
+	compose.Report.SetData(cacheResults(entries))
+	compose.Report.Printf("Removed %d cached repos (%s) from %s\n", len(entries), formatSize(freed), manager.CacheDir())
+	return nil
+}
+
+// listCache returns the cached checkouts, reporting other paths in the cache directory,
+// which the cache commands leave alone
+func listCache(manager *git.Manager) ([]git.CacheEntry, error) {
+	entries, skipped, err := manager.ListCache()
+	if err != nil {
+		return nil, err
+	}
+	for _, skip := range skipped {
+		compose.Report.Printf("  ! skipping %s: %s\n", skip.Path, skip.Reason)
+	}
+	return entries, nil
+}
+
+// cacheResult is a cache entry as reported by --output json|yaml
+type cacheResult struct {
+	git.CacheEntry
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// cacheResults converts cache entries for the result document
+func cacheResults(entries []git.CacheEntry) []cacheResult {
+	results := make([]cacheResult, 0, len(entries))
+	for _, e := range entries {
+		results = append(results, cacheResult{CacheEntry: e, Path: e.Path, Size: e.Size})
+	}
+	return results
+}
+
+// shortCommit abbreviates a commit SHA for display
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// valueOr returns s, or fallback if s is empty
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// formatSize formats a byte count using binary units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -11,45 +11,83 @@ import (
 
 func newDownCmd() *cobra.Command {
 	var force bool
+	var deleteSpaces bool
+	var selFlags selectionFlags
 
 	cmd := &cobra.Command{
-		Use:   "down",
+		Use:   "down [SPACE[/UNIT]...]",
 		Short: "Delete config units from ConfigHub",
 		Long: `The down command reads configs.yaml and deletes the corresponding
-units from ConfigHub. Units that don't exist are skipped.`,
+units from ConfigHub. Units that don't exist are skipped.
+
+Space and unit names are resolved exactly like up (including space-prefix),
+but no commands are executed. Repositories are only cloned if they declare
+unit-sets, whose units depend on the repository contents.
+
+With --delete-spaces, spaces that were created by cub-compose (labeled
+CreatedBy=cub-compose) are deleted as well once they no longer contain any
+units. Other spaces are never deleted, even if up added the Project label
+to them.
+
+Arguments and the --space, --repo and --selector flags limit down to some of
+the units, like they do for up.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDown(force)
+			sel, err := selFlags.selection(args)
+			if err != nil {
+				return err
+			}
+			return runDown(cmd.Context(), sel, force, deleteSpaces)
 		},
 	}
 
 	cmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompt")
+	cmd.Flags().BoolVar(&deleteSpaces, "delete-spaces", false, "Also delete spaces created by cub-compose once they are empty")
+	addSelectionFlags(cmd, &selFlags)
 
 	return cmd
 }
 
-func runDown(force bool) error {
-	fmt.Printf("Loading config from %s...\n", configFile)
+func runDown(ctx context.Context, sel *compose.Selection, force, deleteSpaces bool) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
 
-	// Load the compose config
-	cfg, err := compose.LoadConfig(configFile)
+	// Units generated by unit-sets depend on the repo contents
+	executor, err := newExecutor()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
+	}
+	executor.Selection = sel
+	if err := executor.ExpandUnitSets(ctx, cfg); err != nil {
+		return fmt.Errorf("failed to expand unit-sets: %w", err)
 	}
 
-	// Get the list of units (without resolving content)
+	// Get the list of spaces and units (without resolving content)
+	spaces := compose.ResolveSpaces(cfg)
 	units := compose.GetAllUnits(cfg)
+	if !sel.IsEmpty() && len(units) == 0 {
+		return fmt.Errorf("no units match %s", sel)
+	}
 
-	fmt.Printf("Found %d units to delete\n", len(units))
+	compose.Report.Printf("Found %d units to delete\n", len(units))
 	for _, u := range units {
-		fmt.Printf("  - %s/%s\n", u.SpaceName, u.UnitName)
+		compose.Report.Printf("  - %s/%s\n", u.SpaceName, u.UnitName)
+	}
+
+	if deleteSpaces {
+		compose.Report.Printf("Spaces to delete if created by cub-compose and empty:\n")
+		for _, s := range spaces {
+			compose.Report.Printf("  - %s\n", s.Name)
+		}
 	}
 
 	if !force {
-		fmt.Print("\nAre you sure you want to delete these units? [y/N] ")
+		compose.Report.Printf("\nAre you sure you want to delete these units? [y/N] ")
 		var response string
 		fmt.Scanln(&response)
 		if response != "y" && response != "Y" {
-			fmt.Println("Aborted")
+			compose.Report.Println("Aborted")
 			return nil
 		}
 	}
@@ -60,11 +98,18 @@ func runDown(force bool) error {
 		return fmt.Errorf("failed to create syncer: %w", err)
 	}
 
-	fmt.Println("\nDeleting from ConfigHub...")
-	if err := syncer.SyncDown(context.Background(), units); err != nil {
+	compose.Report.Println("\nDeleting from ConfigHub...")
+	if err := syncer.SyncDown(ctx, units); err != nil {
 		return fmt.Errorf("failed to delete: %w", err)
 	}
 
-	fmt.Println("\nDone!")
+	if deleteSpaces {
+		compose.Report.Println("\nDeleting empty spaces...")
+		if err := syncer.DeleteEmptySpaces(ctx, spaces); err != nil {
+			return fmt.Errorf("failed to delete spaces: %w", err)
+		}
+	}
+
+	compose.Report.Println("\nDone!")
 	return nil
 }
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+
+	"github.com/confighub/cub-compose/pkg/compose"
 )
 
 var (
-	configFile string
-	verbose    bool
+	configFiles []string
+	verbose     bool
+	parallel    int
+	maxAttempts int
+	offline     bool
+	noPull      bool
+	cacheDir    string
+
+	repoOverrides []string
+	setVars       []string
+	outputFormat  string
 )
 
 func main() {
@@ -25,15 +39,69 @@ and syncs it to ConfigHub.
 Authentication uses existing cub CLI credentials from ~/.confighub/`,
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&configFile, "file", "f", "configs.yaml", "Path to configs.yaml file")
+	rootCmd.PersistentFlags().StringArrayVarP(&configFiles, "file", "f", []string{"configs.yaml"}, "Path to configs.yaml file (repeatable; later files override earlier ones)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	rootCmd.PersistentFlags().StringArrayVar(&setVars, "set", nil, "Set a config variable, overriding vars and the environment (NAME=VALUE, repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&repoOverrides, "repo-override", nil, "Use a local checkout for a declared repo (URL=PATH, repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Use cached repo checkouts without contacting remotes; fail if a repo or ref isn't cached")
+	rootCmd.PersistentFlags().BoolVar(&noPull, "no-pull", false, "Use cached repo checkouts as-is; only clone repos that aren't cached")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Directory for cached repo checkouts (default $CUB_COMPOSE_CACHE_DIR or ~/.cub-compose/repos)")
+	rootCmd.PersistentFlags().IntVar(&parallel, "parallel", 1, "Number of repos, unit commands and API calls to process at once")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", 0, "Number of tries for each ConfigHub API call on transient failures (default $CUB_COMPOSE_MAX_ATTEMPTS or 4)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, or json or yaml for a result document on stdout (progress goes to stderr)")
+
+	// Every command reports through the same reporter, so text and structured output agree
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		reporter, err := compose.NewReporter(cmd.CommandPath(), compose.OutputFormat(outputFormat))
+		if err != nil {
+			return err
+		}
+		compose.Report = reporter
+
+		// 0 is the unset default, which falls back to the environment
+		if cmd.Flags().Changed("max-attempts") && maxAttempts < 1 {
+			return fmt.Errorf("--max-attempts must be at least 1")
+		}
+		compose.MaxAttempts = maxAttempts
+		return nil
+	}
 
 	rootCmd.AddCommand(newUpCmd())
+	rootCmd.AddCommand(newPlanCmd())
 	rootCmd.AddCommand(newDownCmd())
 	rootCmd.AddCommand(newStatusCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newSchemaCmd())
+	rootCmd.AddCommand(newCacheCmd())
+
+	// Cancel running commands and API calls on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := compose.Report.Finish(rootCmd.ExecuteContext(ctx))
+	stop()
 
-	if err := rootCmd.Execute(); err != nil {
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+// Exit codes that tell the stage of a failure apart
+const (
+	exitError   = 1 // any other error, such as an invalid config
+	exitResolve = 2 // units failed to resolve
+	exitSync    = 3 // units failed to sync
+	exitAuth    = 4 // ConfigHub credentials are missing or were rejected
+)
+
+// exitCode returns the exit code for err
+func exitCode(err error) int {
+	switch compose.FailureKindOf(err) {
+	case compose.FailureAuth:
+		return exitAuth
+	case compose.FailureSync:
+		return exitSync
+	case compose.FailureResolve:
+		return exitResolve
 	}
+	return exitError
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confighub/cub-compose/pkg/compose"
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+func newPlanCmd() *cobra.Command {
+	var prune bool
+	var keepGoing bool
+	var selFlags selectionFlags
+
+	cmd := &cobra.Command{
+		Use:   "plan [SPACE[/UNIT]...]",
+		Short: "Show what up would change in ConfigHub",
+		Long: `The plan command resolves all units like up does, fetches the existing
+units from ConfigHub and prints the action for each unit (create, update,
+label-only or unchanged) together with a unified diff of the unit data and
+its labels. No changes are made.
+
+With --prune, the plan also lists managed units and spaces that up --prune
+would delete.
+
+Arguments and the --space, --repo and --selector flags limit the plan to some
+of the units, like they do for up.
+
+With --keep-going, units that fail to resolve are listed at the end and the plan
+covers the others.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sel, err := selFlags.selection(args)
+			if err != nil {
+				return err
+			}
+			compose.KeepGoing = keepGoing
+			return runPlan(cmd.Context(), sel, prune)
+		},
+	}
+
+	cmd.Flags().BoolVar(&prune, "prune", false, "Include managed units and spaces that are no longer declared")
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Plan the units that resolve when others fail, and list the failures at the end")
+	addSelectionFlags(cmd, &selFlags)
+
+	return cmd
+}
+
+func runPlan(ctx context.Context, sel *compose.Selection, prune bool) error {
+	if err := checkPruneSelection(sel, prune); err != nil {
+		return err
+	}
+
+	cfg, spaces, units, failures, err := loadAndResolve(ctx, sel)
+	if err != nil {
+		return err
+	}
+
+	syncer, err := compose.NewSyncer()
+	if err != nil {
+		return fmt.Errorf("failed to create syncer: %w", err)
+	}
+
+	// Units that failed to resolve would show up as pruned
+	if prune && len(failures) > 0 {
+		compose.Report.Printf("  ! Skipping prune: %d units failed to resolve\n", len(failures))
+		prune = false
+	}
+
+	if err := showPlan(ctx, syncer, cfg, spaces, units, prune); err != nil {
+		return err
+	}
+	return reportFailures(failures)
+}
+
+// showPlan computes the plan for the resolved units and prints it
+func showPlan(ctx context.Context, syncer *compose.Syncer, cfg *config.ComposeConfig, spaces []config.ResolvedSpace, units []config.ResolvedUnit, prune bool) error {
+	compose.Report.Println("\nComparing with ConfigHub...")
+	plan, err := syncer.Plan(ctx, units)
+	if err != nil {
+		return fmt.Errorf("failed to plan: %w", err)
+	}
+
+	if prune {
+		if err := syncer.PlanPrune(ctx, plan, cfg.Project, spaces, units); err != nil {
+			return fmt.Errorf("failed to plan prune: %w", err)
+		}
+	}
+
+	compose.Report.Plan(plan, units)
+	return nil
+}
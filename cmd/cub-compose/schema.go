@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/confighub/cub-compose/pkg/compose"
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema for configs.yaml",
+		Long: `The schema command prints the JSON Schema for configs.yaml. It is generated
+from the same types cub-compose loads and validates configs with, so editors
+using it report the same unknown keys and invalid values as validate.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The schema is JSON unless --output yaml asks for YAML
+			return compose.Report.Print(config.JSONSchema())
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/confighub/cub-compose/pkg/compose"
+)
+
+// selectionFlags are the flags that limit up, plan and down to some of the units
+type selectionFlags struct {
+	spaces    []string
+	repos     []string
+	selectors []string
+}
+
+// addSelectionFlags registers the selection flags on a command that takes SPACE[/UNIT] args
+func addSelectionFlags(cmd *cobra.Command, f *selectionFlags) {
+	cmd.Flags().StringArrayVar(&f.spaces, "space", nil, "Only act on units in this space (name or glob pattern, repeatable)")
+	cmd.Flags().StringArrayVar(&f.repos, "repo", nil, "Only act on units from this repo URL or local path (repeatable)")
+	cmd.Flags().StringArrayVarP(&f.selectors, "selector", "l", nil, "Only act on units with these labels (KEY=VALUE[,KEY=VALUE], repeatable)")
+}
+
+// selection builds the unit selection from SPACE[/UNIT] args and the selection flags
+func (f *selectionFlags) selection(args []string) (*compose.Selection, error) {
+	sel := &compose.Selection{
+		Units:  args,
+		Spaces: f.spaces,
+		Repos:  f.repos,
+		Labels: make(map[string]string),
+	}
+	for _, selector := range f.selectors {
+		if err := compose.ParseSelector(selector, sel.Labels); err != nil {
+			return nil, err
+		}
+	}
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+	return sel, nil
+}
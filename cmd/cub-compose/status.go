@@ -18,39 +18,40 @@ using the credentials from ~/.confighub/
 
 It displays the current context information and tests the API connection.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runStatus()
+			return runStatus(cmd.Context())
 		},
 	}
 
 	return cmd
 }
 
-func runStatus() error {
+func runStatus(ctx context.Context) error {
 	// Load config and get context info
 	info, err := compose.GetContextInfo()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	fmt.Printf("Context:      %s\n", info.ContextName)
-	fmt.Printf("Server:       %s\n", info.ServerURL)
-	fmt.Printf("Organization: %s\n", info.OrganizationName)
-	fmt.Printf("User:         %s\n", info.User)
+	compose.Report.SetContext(info)
+	compose.Report.Printf("Context:      %s\n", info.ContextName)
+	compose.Report.Printf("Server:       %s\n", info.ServerURL)
+	compose.Report.Printf("Organization: %s\n", info.OrganizationName)
+	compose.Report.Printf("User:         %s\n", info.User)
 
 	// Try to authenticate
 	syncer, err := compose.NewSyncer()
 	if err != nil {
-		fmt.Printf("Auth:         FAILED\n")
+		compose.Report.Printf("Auth:         FAILED\n")
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 
 	// Test the connection by listing spaces
-	err = syncer.TestConnection(context.Background())
+	err = syncer.TestConnection(ctx)
 	if err != nil {
-		fmt.Printf("Auth:         FAILED\n")
+		compose.Report.Printf("Auth:         FAILED\n")
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 
-	fmt.Printf("Auth:         OK\n")
+	compose.Report.Printf("Auth:         OK\n")
 	return nil
 }
@@ -3,73 +3,200 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/confighub/cub-compose/pkg/compose"
+	"github.com/confighub/cub-compose/pkg/config"
+	"github.com/confighub/cub-compose/pkg/git"
 )
 
 func newUpCmd() *cobra.Command {
 	var dryRun bool
+	var prune bool
+	var keepGoing bool
+	var selFlags selectionFlags
 
 	cmd := &cobra.Command{
-		Use:   "up",
+		Use:   "up [SPACE[/UNIT]...]",
 		Short: "Create or update config units in ConfigHub",
 		Long: `The up command reads configs.yaml, clones/pulls the specified repositories,
 executes the configured commands to generate config content, and creates or
-updates the corresponding units in ConfigHub.`,
+updates the corresponding units in ConfigHub.
+
+With --dry-run, up prints the same plan as the plan command and makes no changes.
+
+With --prune, units labeled with the config's project that are no longer declared
+are deleted after syncing, along with undeclared project spaces left empty.
+
+Arguments and the --space, --repo and --selector flags limit up to some of the
+units (e.g. up production/backend); only the repos those units need are cloned.
+
+With --keep-going, units that fail to resolve or sync don't stop the others: every
+unit that succeeds is synced, and the failures are listed at the end. The exit code
+tells resolve (2), sync (3) and auth (4) failures apart.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runUp(dryRun)
+			sel, err := selFlags.selection(args)
+			if err != nil {
+				return err
+			}
+			compose.KeepGoing = keepGoing
+			return runUp(cmd.Context(), sel, dryRun, prune)
 		},
 	}
 
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Delete managed units and spaces that are no longer declared")
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Sync the units that succeed when others fail, and list the failures at the end")
+	addSelectionFlags(cmd, &selFlags)
 
 	return cmd
 }
 
-func runUp(dryRun bool) error {
-	fmt.Printf("Loading config from %s...\n", configFile)
+// loadConfig loads and merges the config files and applies --repo-override
+func loadConfig() (*config.ComposeConfig, error) {
+	compose.Report.Printf("Loading config from %s...\n", strings.Join(configFiles, ", "))
 
 	// Load the compose config
-	cfg, err := compose.LoadConfig(configFile)
+	set, err := parseSetVars(setVars)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := compose.LoadConfig(configFiles, set)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Create executor and resolve all units
-	executor, err := compose.NewExecutor()
+	// Redirect repos to local checkouts
+	overrides, err := parseRepoOverrides(repoOverrides)
 	if err != nil {
-		return fmt.Errorf("failed to create executor: %w", err)
+		return nil, err
+	}
+	if err := compose.ApplyRepoOverrides(cfg, overrides); err != nil {
+		return nil, fmt.Errorf("invalid --repo-override: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// newExecutor creates an executor configured by the global flags
+func newExecutor() (*compose.Executor, error) {
+	executor, err := compose.NewExecutor(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create executor: %w", err)
 	}
 
-	// Set verbose mode
+	// Set verbose mode and concurrency
 	compose.Verbose = verbose
+	if parallel < 1 {
+		return nil, fmt.Errorf("--parallel must be at least 1")
+	}
+	compose.Parallel = parallel
+
+	// Choose whether cached repos are fetched
+	switch {
+	case offline:
+		compose.RepoUpdate = git.UpdateNever
+	case noPull:
+		compose.RepoUpdate = git.UpdateMissing
+	}
+
+	return executor, nil
+}
+
+// loadAndResolve loads configs.yaml and resolves the selected spaces and units. With
+// --keep-going, it also returns the units that failed to resolve.
+func loadAndResolve(ctx context.Context, sel *compose.Selection) (*config.ComposeConfig, []config.ResolvedSpace, []config.ResolvedUnit, compose.Failures, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 
-	// Resolve spaces (for labels)
-	spaces := executor.ResolveSpaces(cfg)
+	// Create executor and resolve all units
+	executor, err := newExecutor()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	executor.Selection = sel
 
-	fmt.Println("Resolving units...")
-	units, err := executor.ResolveUnits(cfg)
+	compose.Report.Println("Resolving units...")
+	units, err := executor.ResolveUnits(ctx, cfg)
+	failures, err := compose.Recoverable(err)
 	if err != nil {
-		return fmt.Errorf("failed to resolve units: %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("failed to resolve units: %w", err)
+	}
+	if !sel.IsEmpty() && len(units) == 0 && len(failures) == 0 {
+		return nil, nil, nil, nil, fmt.Errorf("no units match %s", sel)
 	}
 
-	fmt.Printf("Found %d spaces and %d units to sync\n", len(spaces), len(units))
+	// Resolve spaces (for labels); only spaces of selected units remain in cfg
+	spaces := compose.ResolveSpaces(cfg)
+
+	compose.Report.Printf("Found %d spaces and %d units to sync", len(spaces), len(units))
+	if !sel.IsEmpty() {
+		compose.Report.Printf(" (selected by %s)", sel)
+	}
+	if len(failures) > 0 {
+		compose.Report.Printf(", %d failed to resolve", len(failures))
+	}
+	compose.Report.Println()
 
 	if verbose {
 		for _, u := range units {
-			fmt.Printf("  - %s/%s (%d bytes)", u.SpaceName, u.UnitName, len(u.Content))
+			compose.Report.Printf("  - %s/%s (%d bytes)", u.SpaceName, u.UnitName, len(u.Content))
 			if len(u.Labels) > 0 {
-				fmt.Printf(" labels=%v", u.Labels)
+				compose.Report.Printf(" labels=%v", u.Labels)
 			}
-			fmt.Println()
+			compose.Report.Println()
 		}
 	}
 
-	if dryRun {
-		fmt.Println("\nDry run - no changes made")
-		return nil
+	return cfg, spaces, units, failures, nil
+}
+
+// parseRepoOverrides parses URL=PATH values of --repo-override
+func parseRepoOverrides(values []string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, v := range values {
+		repoURL, path, ok := strings.Cut(v, "=")
+		if !ok || repoURL == "" || path == "" {
+			return nil, fmt.Errorf("invalid --repo-override %q: expected URL=PATH", v)
+		}
+		overrides[repoURL] = path
+	}
+	return overrides, nil
+}
+
+// parseSetVars parses NAME=VALUE values of --set
+func parseSetVars(values []string) (map[string]string, error) {
+	set := make(map[string]string)
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --set %q: expected NAME=VALUE", v)
+		}
+		set[name] = value
+	}
+	return set, nil
+}
+
+// checkPruneSelection rejects --prune with a selection, which would delete every unselected unit
+func checkPruneSelection(sel *compose.Selection, prune bool) error {
+	if prune && !sel.IsEmpty() {
+		return fmt.Errorf("--prune can't be combined with a selection: unselected units would be deleted")
+	}
+	return nil
+}
+
+func runUp(ctx context.Context, sel *compose.Selection, dryRun, prune bool) error {
+	if err := checkPruneSelection(sel, prune); err != nil {
+		return err
+	}
+
+	cfg, spaces, units, failures, err := loadAndResolve(ctx, sel)
+	if err != nil {
+		return err
 	}
 
 	// Create syncer and sync up
@@ -78,11 +205,53 @@ func runUp(dryRun bool) error {
 		return fmt.Errorf("failed to create syncer: %w", err)
 	}
 
-	fmt.Println("\nSyncing to ConfigHub...")
-	if err := syncer.SyncUp(context.Background(), spaces, units); err != nil {
+	if dryRun {
+		if err := showPlan(ctx, syncer, cfg, spaces, units, prune); err != nil {
+			return err
+		}
+		compose.Report.Println("\nDry run - no changes made")
+		return reportFailures(failures)
+	}
+
+	// Work out what to prune before syncing so the list reflects the declared state.
+	// Units that failed to resolve are missing from units, so nothing is pruned then.
+	prunePlan := &compose.Plan{}
+	if prune && len(failures) > 0 {
+		compose.Report.Printf("  ! Skipping prune: %d units failed to resolve\n", len(failures))
+	} else if prune {
+		if err := syncer.PlanPrune(ctx, prunePlan, cfg.Project, spaces, units); err != nil {
+			return fmt.Errorf("failed to plan prune: %w", err)
+		}
+		compose.Report.PrintPrune(prunePlan)
+	}
+
+	compose.Report.Println("\nSyncing to ConfigHub...")
+	syncFailures, err := compose.Recoverable(syncer.SyncUp(ctx, spaces, units))
+	if err != nil {
 		return fmt.Errorf("failed to sync: %w", err)
 	}
+	failures = append(failures, syncFailures...)
 
-	fmt.Println("\nDone!")
+	if len(prunePlan.Prune) > 0 || len(prunePlan.PruneSpaces) > 0 {
+		compose.Report.Println("\nPruning from ConfigHub...")
+		if err := syncer.Prune(ctx, prunePlan); err != nil {
+			return fmt.Errorf("failed to prune: %w", err)
+		}
+	}
+
+	if len(failures) > 0 {
+		return reportFailures(failures)
+	}
+	compose.Report.Println("\nDone!")
 	return nil
 }
+
+// reportFailures prints the failures collected by --keep-going and returns them as the
+// command's error, or returns nil if there are none
+func reportFailures(failures compose.Failures) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	compose.Report.Failures(failures)
+	return failures
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confighub/cub-compose/pkg/compose"
+)
+
+func newValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check configs.yaml for errors",
+		Long: `The validate command loads configs.yaml (with includes, additional -f files
+and --set variables) and reports every problem with the file and line it comes
+from: unknown keys, invalid space and unit names or label keys, units declared
+more than once, units with both or neither of cmd and files, and invalid
+settings. No repositories are cloned and ConfigHub is not contacted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runValidate()
+		},
+	}
+
+	return cmd
+}
+
+func runValidate() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	unitSets := 0
+	for _, repoCfg := range cfg.Configs {
+		for _, space := range repoCfg.Spaces {
+			if space != nil {
+				unitSets += len(space.UnitSets)
+			}
+		}
+	}
+
+	spaces := compose.ResolveSpaces(cfg)
+	units := compose.GetAllUnits(cfg)
+	compose.Report.Declared(units)
+	compose.Report.Printf("  ✓ %s: %d repos, %d spaces, %d units", strings.Join(configFiles, ", "), len(cfg.Configs), len(spaces), len(units))
+	if unitSets > 0 {
+		compose.Report.Printf(", %d unit-sets", unitSets)
+	}
+	compose.Report.Println()
+	return nil
+}
@@ -0,0 +1,95 @@
+package compose
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	pkgconfig "github.com/confighub/cub-compose/pkg/config"
+	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
+	"github.com/confighub/sdk/workerapi"
+)
+
+// unitToolchain returns the toolchain type used for a unit, defaulting to Kubernetes/YAML
+func unitToolchain(unit pkgconfig.ResolvedUnit) string {
+	if unit.Toolchain == "" {
+		return string(workerapi.ToolchainKubernetesYAML)
+	}
+	return unit.Toolchain
+}
+
+// unitChanged reports whether syncing the unit would change the existing ConfigHub unit
+func unitChanged(existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) bool {
+	return dataChanged(existingUnit, unit) || labelsChanged(existingUnit, unit) || annotationsChanged(existingUnit, unit)
+}
+
+// dataChanged reports whether the unit's content or toolchain differs from the existing unit
+func dataChanged(existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) bool {
+	toolchainType := unitToolchain(unit)
+	if existingUnit.ToolchainType != toolchainType {
+		return true
+	}
+	return !contentEqual(toolchainType, existingUnit.Data, string(unit.Content))
+}
+
+// labelsChanged reports whether merging the unit's labels would change the existing labels
+func labelsChanged(existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) bool {
+	return !maps.Equal(existingUnit.Labels, mergeLabels(existingUnit.Labels, unit.Labels))
+}
+
+// annotationsChanged reports whether the unit's source annotations are missing from the
+// existing unit, e.g. because it was created before they were added, or point at another
+// repo or dir. A new GitCommit alone doesn't count, so that a commit that leaves the content
+// unchanged doesn't create a revision of every unit; GitCommit is updated with the content.
+func annotationsChanged(existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) bool {
+	for k, v := range sourceAnnotations(unit) {
+		old, ok := existingUnit.Annotations[k]
+		if !ok || (old != v && k != gitCommitAnnotation) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentEqual compares unit data; YAML content is compared after parsing so that
+// formatting-only differences (indentation, quoting, key order) are ignored
+func contentEqual(toolchainType, a, b string) bool {
+	if a == b {
+		return true
+	}
+	if toolchainType != string(workerapi.ToolchainKubernetesYAML) {
+		return strings.TrimRight(a, "\n") == strings.TrimRight(b, "\n")
+	}
+
+	docsA, errA := decodeYAMLDocuments(a)
+	docsB, errB := decodeYAMLDocuments(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return reflect.DeepEqual(docsA, docsB)
+}
+
+// decodeYAMLDocuments decodes every non-empty document in a YAML stream
+func decodeYAMLDocuments(data string) ([]any, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(data))
+
+	var docs []any
+	for {
+		var doc any
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
@@ -0,0 +1,163 @@
+package compose
+
+import (
+	"testing"
+
+	pkgconfig "github.com/confighub/cub-compose/pkg/config"
+	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
+)
+
+func TestContentEqual(t *testing.T) {
+	const yamlType, propsType = "Kubernetes/YAML", "AppConfig/Properties"
+	tests := []struct {
+		name      string
+		toolchain string
+		a, b      string
+		want      bool
+	}{
+		{"identical", yamlType, "a: 1\n", "a: 1\n", true},
+		{"yaml indentation", yamlType, "a:\n  b: 1\n", "a:\n    b: 1\n", true},
+		{"yaml quoting", yamlType, "a: \"x\"\n", "a: x\n", true},
+		{"yaml key order", yamlType, "a: 1\nb: 2\n", "b: 2\na: 1\n", true},
+		{"yaml trailing newline", yamlType, "a: 1", "a: 1\n", true},
+		{"yaml empty documents", yamlType, "---\na: 1\n---\n", "a: 1\n", true},
+		{"yaml value", yamlType, "a: 1\n", "a: 2\n", false},
+		{"yaml type", yamlType, "a: 1\n", "a: \"1\"\n", false},
+		{"yaml document order", yamlType, "a: 1\n---\nb: 2\n", "b: 2\n---\na: 1\n", false},
+		{"invalid yaml", yamlType, "a: [\n", "a: [\n ", false},
+		{"other toolchain trailing newlines", propsType, "a=1", "a=1\n\n", true},
+		{"other toolchain indentation", propsType, "a=1\n", "  a=1\n", false},
+		{"other toolchain spaces", propsType, "a=1\n", "a = 1\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentEqual(tt.toolchain, tt.a, tt.b); got != tt.want {
+				t.Errorf("contentEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitChanged(t *testing.T) {
+	const data = "a: 1\n"
+	tests := []struct {
+		name     string
+		existing goclientnew.Unit
+		unit     pkgconfig.ResolvedUnit
+		data     bool // dataChanged
+		labels   bool // labelsChanged
+	}{
+		{
+			name:     "unchanged",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML", Labels: map[string]string{"Env": "dev"}},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data), Labels: map[string]string{"Env": "dev"}},
+		},
+		{
+			name:     "nil labels in ConfigHub and none declared",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data), Labels: map[string]string{}},
+		},
+		{
+			name:     "empty labels in ConfigHub and none declared",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML", Labels: map[string]string{}},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data)},
+		},
+		{
+			name:     "only whitespace differs",
+			existing: goclientnew.Unit{Data: "a:   1\n\n", ToolchainType: "Kubernetes/YAML"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data)},
+		},
+		{
+			name:     "label-only change",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML", Labels: map[string]string{"Env": "dev"}},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data), Labels: map[string]string{"Env": "prod"}},
+			labels:   true,
+		},
+		{
+			name:     "label added to nil labels",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data), Labels: map[string]string{"Env": "dev"}},
+			labels:   true,
+		},
+		{
+			name:     "labels only in ConfigHub are kept",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML", Labels: map[string]string{"Owner": "ops"}},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data)},
+		},
+		{
+			name:     "toolchain changed in ConfigHub",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "AppConfig/Properties"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data)},
+			data:     true,
+		},
+		{
+			name:     "toolchain changed in configs.yaml",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte(data), Toolchain: "AppConfig/Properties"},
+			data:     true,
+		},
+		{
+			name:     "same non-default toolchain",
+			existing: goclientnew.Unit{Data: "a=1\n", ToolchainType: "AppConfig/Properties"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte("a=1\n"), Toolchain: "AppConfig/Properties"},
+		},
+		{
+			name:     "content changed",
+			existing: goclientnew.Unit{Data: data, ToolchainType: "Kubernetes/YAML"},
+			unit:     pkgconfig.ResolvedUnit{Content: []byte("a: 2\n")},
+			data:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dataChanged(&tt.existing, tt.unit); got != tt.data {
+				t.Errorf("dataChanged = %v, want %v", got, tt.data)
+			}
+			if got := labelsChanged(&tt.existing, tt.unit); got != tt.labels {
+				t.Errorf("labelsChanged = %v, want %v", got, tt.labels)
+			}
+			if got := unitChanged(&tt.existing, tt.unit); got != (tt.data || tt.labels) {
+				t.Errorf("unitChanged = %v, want %v", got, tt.data || tt.labels)
+			}
+		})
+	}
+}
+
+func TestAnnotationsChanged(t *testing.T) {
+	unit := pkgconfig.ResolvedUnit{RepoURL: "https://example.com/app.git", Commit: "abc123", Dir: "app"}
+	current := map[string]string{gitRepoAnnotation: unit.RepoURL, gitCommitAnnotation: unit.Commit, gitDirAnnotation: unit.Dir}
+	with := func(k, v string) map[string]string {
+		annotations := make(map[string]string)
+		for key, value := range current {
+			annotations[key] = value
+		}
+		if v == "" {
+			delete(annotations, k)
+		} else {
+			annotations[k] = v
+		}
+		return annotations
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{"same", current, false},
+		{"none", nil, true},
+		{"missing commit", with(gitCommitAnnotation, ""), true},
+		{"other commit", with(gitCommitAnnotation, "def456"), false},
+		{"other dir", with(gitDirAnnotation, "other"), true},
+		{"other repo", with(gitRepoAnnotation, "https://example.com/other.git"), true},
+		{"extra annotation", with("Owner", "ops"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := &goclientnew.Unit{Annotations: tt.annotations}
+			if got := annotationsChanged(existing, unit); got != tt.want {
+				t.Errorf("annotationsChanged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
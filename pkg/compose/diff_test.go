@@ -0,0 +1,145 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"both empty", "", "", ""},
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{
+			name: "from empty",
+			from: "",
+			to:   "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "to empty",
+			from: "a\nb\n",
+			to:   "",
+			want: "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "insert only",
+			from: "a\nb\nc\n",
+			to:   "a\nb\nx\nc\n",
+			want: "@@ -1,3 +1,4 @@\n a\n b\n+x\n c\n",
+		},
+		{
+			name: "delete only",
+			from: "a\nb\nx\nc\n",
+			to:   "a\nb\nc\n",
+			want: "@@ -1,4 +1,3 @@\n a\n b\n-x\n c\n",
+		},
+		{
+			name: "change",
+			from: "a\nb\nc\n",
+			to:   "a\nB\nc\n",
+			want: "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "mixed",
+			from: "a\nb\nc\nd\ne\n",
+			to:   "x\na\nc\nd\nE\ne\n",
+			want: "@@ -1,5 +1,6 @@\n+x\n a\n-b\n c\n d\n+E\n e\n",
+		},
+		{
+			name: "context is limited to three lines",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "1\n2\n3\n4\n5\n6\n7\nX\n",
+			want: "@@ -5,4 +5,4 @@\n 5\n 6\n 7\n-8\n+X\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			from: "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			to:   "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			// Lines are compared without their newlines, so there are no hunks
+			name: "missing trailing newline on one side",
+			from: "a\nb",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n",
+		},
+		{
+			name: "missing trailing newline with a change",
+			from: "a\nb",
+			to:   "a\nc",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("old", "new", tt.from, tt.to)
+			if tt.want != "" && !strings.HasPrefix(tt.want, "---") {
+				tt.want = "--- old\n+++ new\n" + tt.want
+			}
+			if got != tt.want {
+				t.Errorf("unifiedDiff(%q, %q) =\n%s\nwant:\n%s", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		edits int // minimal number of added and removed lines
+	}{
+		{"empty", nil, nil, 0},
+		{"identical", []string{"a", "b"}, []string{"a", "b"}, 0},
+		{"insert only", nil, []string{"a", "b"}, 2},
+		{"delete only", []string{"a", "b"}, nil, 2},
+		{"replace", []string{"a"}, []string{"b"}, 2},
+		{"insert in the middle", []string{"a", "c"}, []string{"a", "b", "c"}, 1},
+		{"mixed", []string{"a", "b", "c", "a", "b", "b", "a"}, []string{"c", "b", "a", "b", "a", "c"}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(tt.a, tt.b)
+
+			edits := 0
+			var a, b []string
+			for _, op := range ops {
+				if op.kind != ' ' {
+					edits++
+				}
+				if op.kind != '+' {
+					a = append(a, op.line)
+				}
+				if op.kind != '-' {
+					b = append(b, op.line)
+				}
+			}
+			if edits != tt.edits {
+				t.Errorf("diffLines made %d edits, want %d: %+v", edits, tt.edits, ops)
+			}
+			// Applying the script must give back both inputs
+			if !reflect.DeepEqual(a, tt.a) || !reflect.DeepEqual(b, tt.b) {
+				t.Errorf("diffLines = %+v, doesn't turn %q into %q", ops, tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestDiffLinesTooManyEdits(t *testing.T) {
+	a := make([]string, maxDiffEdits+1)
+	b := make([]string, maxDiffEdits+1)
+	for i := range a {
+		a[i] = "a"
+		b[i] = "b"
+	}
+	ops := diffLines(a, b)
+	if len(ops) != len(a)+len(b) || ops[0].kind != '-' || ops[len(ops)-1].kind != '+' {
+		t.Errorf("diffLines returned %d ops, want a full replacement", len(ops))
+	}
+}
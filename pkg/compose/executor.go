@@ -2,25 +2,33 @@ package compose
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"slices"
+	"sort"
+	"time"
 
 	"github.com/confighub/cub-compose/pkg/config"
 	"github.com/confighub/cub-compose/pkg/git"
+	"github.com/confighub/sdk/workerapi"
 )
 
 // Executor handles command execution for units
 type Executor struct {
 	gitManager *git.Manager
+
+	// Selection limits which units are resolved and which repos are cloned (nil for all)
+	Selection *Selection
 }
 
-// NewExecutor creates a new executor
-func NewExecutor() (*Executor, error) {
-	gitMgr, err := git.NewManager()
+// NewExecutor creates a new executor that caches repos in cacheDir (empty for the default)
+func NewExecutor(cacheDir string) (*Executor, error) {
+	gitMgr, err := git.NewManager(cacheDir)
 	if err != nil {
 		return nil, err
 	}
@@ -50,14 +58,24 @@ func applySpacePrefix(cfg *config.ComposeConfig, spaceName string) string {
 	return spaceName
 }
 
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ResolveSpaces returns all unique spaces with their labels
-func (e *Executor) ResolveSpaces(cfg *config.ComposeConfig) []config.ResolvedSpace {
+func ResolveSpaces(cfg *config.ComposeConfig) []config.ResolvedSpace {
 	baseLabels := buildBaseLabels(cfg)
 	seen := make(map[string]bool)
 	var spaces []config.ResolvedSpace
 
 	for _, repoCfg := range cfg.Configs {
-		for spaceName := range repoCfg.Spaces {
+		for _, spaceName := range sortedKeys(repoCfg.Spaces) {
 			fullName := applySpacePrefix(cfg, spaceName)
 			if seen[fullName] {
 				continue
@@ -80,77 +98,349 @@ func (e *Executor) ResolveSpaces(cfg *config.ComposeConfig) []config.ResolvedSpa
 	return spaces
 }
 
-// ResolveUnits clones repos and executes commands for all units
-func (e *Executor) ResolveUnits(cfg *config.ComposeConfig) ([]config.ResolvedUnit, error) {
-	var resolved []config.ResolvedUnit
-	baseLabels := buildBaseLabels(cfg)
+// gitAuth converts repo auth settings into git credentials, reading the token from the environment
+func gitAuth(auth *config.RepoAuth) (*git.Auth, error) {
+	if auth == nil {
+		return nil, nil
+	}
 
-	// Process each repo
-	for _, repoCfg := range cfg.Configs {
-		repoPath, err := e.gitManager.EnsureRepo(repoCfg.Repo, repoCfg.Ref)
-		if err != nil {
-			return nil, fmt.Errorf("failed to ensure repo %s: %w", repoCfg.Repo, err)
+	result := &git.Auth{
+		SSHKeyPath:       auth.SSHKey,
+		KnownHostsPath:   auth.KnownHosts,
+		Username:         auth.Username,
+		CredentialHelper: auth.CredentialHelper,
+	}
+
+	if auth.TokenEnv != "" {
+		result.Token = os.Getenv(auth.TokenEnv)
+		if result.Token == "" {
+			return nil, fmt.Errorf("auth token variable %s is not set", auth.TokenEnv)
 		}
+	}
+
+	return result, nil
+}
+
+// repoRef formats a repo and its ref for messages
+func repoRef(repoURL, ref string) string {
+	if ref == "" {
+		return repoURL
+	}
+	return repoURL + "@" + ref
+}
+
+// unitJob is a declared unit waiting to be resolved
+type unitJob struct {
+	repoIndex int
+	spaceName string
+	unitName  string
+	unit      *config.Unit
+}
 
-		// Process each space
-		for spaceName, space := range repoCfg.Spaces {
+// collectUnitJobs lists all declared units in repo order, then by space and unit name
+func collectUnitJobs(cfg *config.ComposeConfig) []unitJob {
+	var jobs []unitJob
+	for i, repoCfg := range cfg.Configs {
+		for _, spaceName := range sortedKeys(repoCfg.Spaces) {
+			space := repoCfg.Spaces[spaceName]
 			if space == nil || len(space.Units) == 0 {
 				continue
 			}
+			for _, unitName := range sortedKeys(space.Units) {
+				jobs = append(jobs, unitJob{
+					repoIndex: i,
+					spaceName: spaceName,
+					unitName:  unitName,
+					unit:      space.Units[unitName],
+				})
+			}
+		}
+	}
+	return jobs
+}
 
-			fullSpaceName := applySpacePrefix(cfg, spaceName)
+// checkout is a repo at a specific ref, or a local directory; configs with the same
+// URL and ref (or path) share one
+type checkout struct {
+	repoURL string
+	ref     string
+	auth    *config.RepoAuth
+	local   bool
+	path    string
+	commit  string
+	err     error // why the checkout failed, with KeepGoing
+}
 
-			// Process each unit
-			for unitName, unit := range space.Units {
-				var content []byte
-				var err error
+// checkoutRepos clones or fetches the repos of the configs selected by need (all if nil)
+// and returns the checkout of each config, nil for configs that weren't selected.
+// Failed checkouts record their error, so with KeepGoing the others can still be used.
+func (e *Executor) checkoutRepos(ctx context.Context, cfg *config.ComposeConfig, need func(*config.RepoConfig) bool) ([]*checkout, error) {
+	e.gitManager.Update = RepoUpdate
+	e.gitManager.Output = Report.Writer()
+
+	// Each (URL, ref) gets its own working tree, so distinct checkouts can be fetched concurrently
+	var checkouts []*checkout
+	repoCheckouts := make([]*checkout, len(cfg.Configs))
+	byKey := make(map[string]*checkout)
+	for i, repoCfg := range cfg.Configs {
+		if need != nil && !need(&cfg.Configs[i]) {
+			continue
+		}
+		key := repoCfg.Repo + "\x00" + repoCfg.Ref
+		if repoCfg.IsLocal() {
+			key = "path\x00" + repoCfg.Path
+		}
+		co, ok := byKey[key]
+		if !ok {
+			co = &checkout{repoURL: repoCfg.Repo, ref: repoCfg.Ref, auth: repoCfg.Auth, local: repoCfg.IsLocal(), path: repoCfg.Path}
+			byKey[key] = co
+			checkouts = append(checkouts, co)
+		}
+		repoCheckouts[i] = co
+	}
 
-				// Use files or cmd to get content
-				if len(unit.Files) > 0 {
-					content, err = e.readFiles(repoPath, unit.Dir, unit.Files)
-				} else if unit.Cmd != "" {
-					content, err = e.executeCommand(repoPath, unit.Dir, unit.Cmd)
-				} else {
-					return nil, fmt.Errorf("unit %s/%s: either 'cmd' or 'files' is required", spaceName, unitName)
-				}
+	err := forEachOrdered(len(checkouts), func(i int, out io.Writer) error {
+		co := checkouts[i]
 
-				if err != nil {
-					return nil, fmt.Errorf("failed to resolve %s/%s: %w", spaceName, unitName, err)
+		// Local directories are used as-is
+		if co.local {
+			info, err := os.Stat(co.path)
+			if err != nil {
+				co.err = fmt.Errorf("local repo path: %w", err)
+			} else if !info.IsDir() {
+				co.err = fmt.Errorf("local repo path %s is not a directory", co.path)
+			}
+			if co.err != nil {
+				return &UnitFailure{Kind: FailureResolve, Repo: co.path, Err: co.err}
+			}
+			co.commit = e.gitManager.LocalCommit(ctx, co.path)
+			if Verbose {
+				fmt.Fprintf(out, "  Using local directory %s", co.path)
+				if co.commit != "" {
+					fmt.Fprintf(out, " at commit %s", co.commit)
 				}
+				fmt.Fprintln(out)
+			}
+			return nil
+		}
 
-				// Merge labels: base (project + common) + repo-level unit-labels + unit-level labels
-				labels := make(map[string]string)
-				for k, v := range baseLabels {
-					labels[k] = v
-				}
-				for k, v := range repoCfg.UnitLabels {
-					labels[k] = v
-				}
-				for k, v := range unit.Labels {
-					labels[k] = v
-				}
+		auth, err := gitAuth(co.auth)
+		if err != nil {
+			co.err = fmt.Errorf("repo %s: %w", co.repoURL, err)
+			return &UnitFailure{Kind: FailureResolve, Repo: co.repoURL, Err: co.err}
+		}
 
-				resolved = append(resolved, config.ResolvedUnit{
-					RepoURL:   repoCfg.Repo,
-					SpaceName: fullSpaceName,
-					UnitName:  unitName,
-					Dir:       unit.Dir,
-					Cmd:       unit.Cmd,
-					Labels:    labels,
-					Content:   content,
-				})
+		co.path, co.commit, err = e.gitManager.EnsureRepo(ctx, co.repoURL, co.ref, auth)
+		if err != nil {
+			co.err = fmt.Errorf("failed to ensure repo %s: %w", co.repoURL, err)
+			return &UnitFailure{Kind: FailureResolve, Repo: co.repoURL, Err: co.err}
+		}
+		// Without a fetch the commit may be stale, so always report it
+		if Verbose || RepoUpdate != git.UpdateAlways {
+			fmt.Fprintf(out, "  Resolved %s to commit %s\n", repoRef(co.repoURL, co.ref), co.commit)
+		}
+		return nil
+	})
+	return repoCheckouts, err
+}
+
+// ExpandUnitSets checks out the repos that declare unit-sets and adds the generated units
+// to cfg, so they can be listed without resolving any content (as down does)
+func (e *Executor) ExpandUnitSets(ctx context.Context, cfg *config.ComposeConfig) error {
+	// Generated names are checked against all declared units, not only the selected ones
+	declared := declaredUnits(cfg)
+	e.Selection.Filter(cfg)
+
+	repoCheckouts, err := e.checkoutRepos(ctx, cfg, hasUnitSets)
+	if err != nil {
+		return err
+	}
+	for i, co := range repoCheckouts {
+		if co == nil {
+			continue
+		}
+		if err := expandUnitSets(cfg, &cfg.Configs[i], co.path, declared, Report.Writer()); err != nil {
+			return fmt.Errorf("config[%d]: %w", i, err)
+		}
+	}
+
+	e.Selection.Filter(cfg)
+	return nil
+}
+
+// ResolveUnits clones repos and executes commands for all units.
+// Up to Parallel repos and unit commands run at once; results are returned in a
+// deterministic order (config order, then space and unit name). With KeepGoing, units
+// whose repo or command fails are left out and returned as Failures with the others.
+func (e *Executor) ResolveUnits(ctx context.Context, cfg *config.ComposeConfig) ([]config.ResolvedUnit, error) {
+	baseLabels := buildBaseLabels(cfg)
+
+	// Generated names are checked against all declared units, not only the selected ones
+	declared := declaredUnits(cfg)
+
+	// Only the repos of selected units are cloned
+	e.Selection.Filter(cfg)
+
+	repoCheckouts, err := e.checkoutRepos(ctx, cfg, nil)
+	if err != nil {
+		if _, ok := unitFailures(err); !KeepGoing || !ok {
+			return nil, err
+		}
+	}
+
+	// Repos that failed to check out or expand are reported once and their units skipped
+	var failures Failures
+	repoFailed := make([]bool, len(cfg.Configs))
+	reported := make(map[*checkout]bool)
+	for i := range cfg.Configs {
+		co := repoCheckouts[i]
+		if co.err != nil {
+			repoFailed[i] = true
+			if !reported[co] {
+				reported[co] = true
+				failures = append(failures, &UnitFailure{Kind: FailureResolve, Repo: cfg.Configs[i].Source(), Err: co.err})
 			}
+			continue
+		}
+		if !hasUnitSets(&cfg.Configs[i]) {
+			continue
+		}
+		if err := expandUnitSets(cfg, &cfg.Configs[i], co.path, declared, Report.Writer()); err != nil {
+			err = fmt.Errorf("config[%d]: %w", i, err)
+			if !KeepGoing {
+				return nil, err
+			}
+			repoFailed[i] = true
+			failures = append(failures, &UnitFailure{Kind: FailureResolve, Repo: cfg.Configs[i].Source(), Err: err})
+		}
+	}
+
+	// Drop generated units that aren't selected, keeping configs aligned with their checkouts
+	e.Selection.filterUnits(cfg)
+
+	var jobs []unitJob
+	for _, job := range collectUnitJobs(cfg) {
+		if !repoFailed[job.repoIndex] {
+			jobs = append(jobs, job)
 		}
 	}
 
+	resolved := make([]config.ResolvedUnit, len(jobs))
+	succeeded := make([]bool, len(jobs))
+	err = forEachOrdered(len(jobs), func(i int, out io.Writer) error {
+		job := jobs[i]
+		co := repoCheckouts[job.repoIndex]
+
+		var err error
+		resolved[i], err = e.resolveUnit(ctx, cfg, &cfg.Configs[job.repoIndex], co.path, co.commit, baseLabels, job, out)
+		if err != nil {
+			// Record the failure with the unit's declared details
+			result := resolvedResult(declareUnit(cfg, &cfg.Configs[job.repoIndex], baseLabels, job))
+			result.Error = err.Error()
+			Report.Unit(out, result)
+			return &UnitFailure{Kind: FailureResolve, Space: result.Space, Unit: job.unitName, Err: err}
+		}
+		succeeded[i] = true
+		return nil
+	})
+	if err != nil {
+		unitFailed, ok := unitFailures(err)
+		if !KeepGoing || !ok {
+			return nil, err
+		}
+		failures = append(failures, unitFailed...)
+	}
+	if len(failures) == 0 {
+		return resolved, nil
+	}
+
+	// Keep the units that resolved
+	var units []config.ResolvedUnit
+	for i, unit := range resolved {
+		if succeeded[i] {
+			units = append(units, unit)
+		}
+	}
+	return units, failures
+}
+
+// resolveUnit generates the content for a single unit and merges its labels
+func (e *Executor) resolveUnit(ctx context.Context, cfg *config.ComposeConfig, repoCfg *config.RepoConfig, repoPath, commit string, baseLabels map[string]string, job unitJob, out io.Writer) (config.ResolvedUnit, error) {
+	unit := job.unit
+
+	var content []byte
+	var err error
+
+	// Use files or cmd to get content
+	if len(unit.Files) > 0 {
+		content, err = e.readFiles(repoPath, unit.Dir, unit.Files, unit.Exclude, out)
+	} else if len(unit.Cmd) > 0 {
+		content, err = e.executeCommand(ctx, repoPath, repoCfg, unit, out)
+	} else {
+		return config.ResolvedUnit{}, fmt.Errorf("unit %s/%s: either 'cmd' or 'files' is required", job.spaceName, job.unitName)
+	}
+
+	if err != nil {
+		return config.ResolvedUnit{}, fmt.Errorf("failed to resolve %s/%s: %w", job.spaceName, job.unitName, err)
+	}
+
+	resolved := declareUnit(cfg, repoCfg, baseLabels, job)
+	resolved.Commit = commit
+	resolved.Content = content
 	return resolved, nil
 }
 
+// declareUnit builds a resolved unit from its declaration, without generating content.
+// Space prefix, merged labels and toolchain are applied exactly as for up.
+func declareUnit(cfg *config.ComposeConfig, repoCfg *config.RepoConfig, baseLabels map[string]string, job unitJob) config.ResolvedUnit {
+	unit := job.unit
+	labels := mergeUnitLabels(baseLabels, repoCfg, unit)
+
+	// Toolchain: unit-level, then repo default, then Kubernetes/YAML
+	toolchain := unit.Toolchain
+	if toolchain == "" {
+		toolchain = repoCfg.Toolchain
+	}
+	if toolchain == "" {
+		toolchain = string(workerapi.ToolchainKubernetesYAML)
+	}
+
+	return config.ResolvedUnit{
+		RepoURL:   repoCfg.Source(),
+		SpaceName: applySpacePrefix(cfg, job.spaceName),
+		UnitName:  job.unitName,
+		Dir:       unit.Dir,
+		Cmd:       unit.Cmd.String(),
+		Labels:    labels,
+		Toolchain: toolchain,
+	}
+}
+
+// mergeUnitLabels merges the labels of a unit: base (project + common) + repo-level
+// unit-labels + unit-level labels
+func mergeUnitLabels(baseLabels map[string]string, repoCfg *config.RepoConfig, unit *config.Unit) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range baseLabels {
+		labels[k] = v
+	}
+	for k, v := range repoCfg.UnitLabels {
+		labels[k] = v
+	}
+	for k, v := range unit.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
 // Verbose controls whether to print detailed execution info
 var Verbose bool
 
-// readFiles reads and concatenates multiple files from a directory using os.Root for safe path handling
-func (e *Executor) readFiles(repoPath, dir string, files []string) ([]byte, error) {
+// RepoUpdate controls whether cached repositories are fetched before resolving units
+var RepoUpdate = git.UpdateAlways
+
+// readFiles reads and concatenates multiple files from a directory using os.Root for safe path handling.
+// Glob patterns in files are expanded within the directory and exclude patterns are left out.
+func (e *Executor) readFiles(repoPath, dir string, files, exclude []string, out io.Writer) ([]byte, error) {
 	// Open repo as root to prevent directory traversal
 	repoRoot, err := os.OpenRoot(repoPath)
 	if err != nil {
@@ -165,14 +455,19 @@ func (e *Executor) readFiles(repoPath, dir string, files []string) ([]byte, erro
 	}
 	defer dirRoot.Close()
 
+	files, err = expandFiles(dirRoot, files, exclude)
+	if err != nil {
+		return nil, err
+	}
+
 	if Verbose {
-		fmt.Printf("  Reading files from: %s/%s\n", repoPath, dir)
+		fmt.Fprintf(out, "  Reading files from: %s/%s\n", repoPath, dir)
 	}
 
 	var result bytes.Buffer
 	for i, file := range files {
 		if Verbose {
-			fmt.Printf("    - %s\n", file)
+			fmt.Fprintf(out, "    - %s\n", file)
 		}
 
 		// Open file safely within the directory root
@@ -202,8 +497,54 @@ func (e *Executor) readFiles(repoPath, dir string, files []string) ([]byte, erro
 	return result.Bytes(), nil
 }
 
-// executeCommand executes a command in the specified directory and returns stdout
-func (e *Executor) executeCommand(repoPath, dir, cmdStr string) ([]byte, error) {
+// defaultPassthroughEnv lists the parent environment variables always passed to unit commands.
+// Everything else must be listed in env-passthrough so secrets don't leak into generators.
+var defaultPassthroughEnv = []string{
+	"PATH", "HOME", "USER", "LANG", "LC_ALL", "TMPDIR", "TZ",
+	"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME",
+}
+
+// killGracePeriod is how long a cancelled command may take to exit before it is killed
+const killGracePeriod = 5 * time.Second
+
+// commandEnv builds the environment for a unit command: allowed parent variables,
+// then repo-level env, then unit-level env
+func commandEnv(repoCfg *config.RepoConfig, unit *config.Unit) []string {
+	env := make(map[string]string)
+
+	passthrough := append(append(slices.Clone(defaultPassthroughEnv), repoCfg.EnvPassthrough...), unit.EnvPassthrough...)
+	for _, name := range passthrough {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+	for k, v := range repoCfg.Env {
+		env[k] = v
+	}
+	for k, v := range unit.Env {
+		env[k] = v
+	}
+
+	result := make([]string, 0, len(env))
+	for _, k := range sortedKeys(env) {
+		result = append(result, k+"="+env[k])
+	}
+	return result
+}
+
+// commandTimeout returns the unit's timeout, falling back to the repo default (0 means none)
+func commandTimeout(repoCfg *config.RepoConfig, unit *config.Unit) time.Duration {
+	if unit.Timeout > 0 {
+		return unit.Timeout
+	}
+	return repoCfg.Timeout
+}
+
+// executeCommand executes a unit's command in its directory and returns stdout.
+// Each step after the first receives the previous step's stdout on stdin.
+func (e *Executor) executeCommand(ctx context.Context, repoPath string, repoCfg *config.RepoConfig, unit *config.Unit, out io.Writer) ([]byte, error) {
+	dir := unit.Dir
+
 	// Use os.OpenRoot to validate the path is within the repo (prevents traversal)
 	repoRoot, err := os.OpenRoot(repoPath)
 	if err != nil {
@@ -221,28 +562,68 @@ func (e *Executor) executeCommand(repoPath, dir, cmdStr string) ([]byte, error)
 
 	// Now safe to use the joined path for command execution
 	workDir := filepath.Join(repoPath, dir)
+	env := commandEnv(repoCfg, unit)
 
-	if Verbose {
-		fmt.Printf("  Executing: %s\n", cmdStr)
-		fmt.Printf("  Working dir: %s\n", workDir)
+	timeout := commandTimeout(repoCfg, unit)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	// Parse the command string
-	parts := strings.Fields(cmdStr)
-	if len(parts) == 0 {
-		return nil, fmt.Errorf("empty command")
+	if Verbose {
+		fmt.Fprintf(out, "  Working dir: %s\n", workDir)
+		if timeout > 0 {
+			fmt.Fprintf(out, "  Timeout: %s\n", timeout)
+		}
 	}
 
-	cmd := exec.Command(parts[0], parts[1:]...)
-	cmd.Dir = workDir
+	var input []byte
+	for i, cmdStr := range unit.Cmd {
+		if Verbose {
+			fmt.Fprintf(out, "  Executing: %s\n", cmdStr)
+		}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+		var cmd *exec.Cmd
+		if unit.Shell {
+			cmd = exec.CommandContext(ctx, "sh", "-c", cmdStr)
+		} else {
+			// Parse the command string
+			parts, err := splitCommand(cmdStr)
+			if err != nil {
+				return nil, err
+			}
+			if len(parts) == 0 {
+				return nil, fmt.Errorf("empty command")
+			}
+			cmd = exec.CommandContext(ctx, parts[0], parts[1:]...)
+		}
+		cmd.Dir = workDir
+		cmd.Env = env
+		cmd.WaitDelay = killGracePeriod
+		setProcessGroup(cmd)
+
+		// Feed the previous step's output to this step
+		if i > 0 {
+			cmd.Stdin = bytes.NewReader(input)
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("command %q timed out after %s in %s\nstderr: %s", cmdStr, timeout, workDir, stderr.String())
+			}
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("command %q cancelled: %w", cmdStr, ctx.Err())
+			}
+			return nil, fmt.Errorf("command %q failed in %s: %w\nstderr: %s", cmdStr, workDir, err, stderr.String())
+		}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("command failed in %s: %w\nstderr: %s", workDir, err, stderr.String())
+		input = stdout.Bytes()
 	}
 
-	return stdout.Bytes(), nil
+	return input, nil
 }
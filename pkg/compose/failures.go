@@ -0,0 +1,187 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// KeepGoing makes up and plan carry on after units fail to resolve or sync; the failures
+// are collected and returned as Failures once everything else is done
+var KeepGoing bool
+
+// FailureKind is the stage at which a unit failed
+type FailureKind string
+
+const (
+	FailureResolve FailureKind = "resolve" // cloning the repo or generating the content
+	FailureSync    FailureKind = "sync"    // writing to ConfigHub
+	FailureAuth    FailureKind = "auth"    // authenticating with ConfigHub
+)
+
+// UnitFailure is the failure of a unit, or of a repo or space and all units in it
+type UnitFailure struct {
+	Kind  FailureKind
+	Space string // empty for repo failures
+	Unit  string // empty for repo and space failures
+	Repo  string // set for repo failures
+	Err   error
+}
+
+// Error returns the underlying error, which names the unit, space or repo
+func (f *UnitFailure) Error() string {
+	return f.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (f *UnitFailure) Unwrap() error {
+	return f.Err
+}
+
+// Failures are the unit failures of a command run with KeepGoing
+type Failures []*UnitFailure
+
+// Error summarizes the failures by kind; Reporter.Failures lists them
+func (f Failures) Error() string {
+	counts := make(map[FailureKind]int)
+	for _, failure := range f {
+		counts[kindOf(failure)]++
+	}
+	var parts []string
+	for _, kind := range []FailureKind{FailureResolve, FailureSync, FailureAuth} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	return fmt.Sprintf("%d failures (%s)", len(f), strings.Join(parts, ", "))
+}
+
+// Unwrap returns the individual failures
+func (f Failures) Unwrap() []error {
+	errs := make([]error, len(f))
+	for i, failure := range f {
+		errs[i] = failure
+	}
+	return errs
+}
+
+// Recoverable splits err into the failures KeepGoing carries on after, and the error that
+// stops the command. Without KeepGoing, or if err isn't made of unit failures, it returns err.
+func Recoverable(err error) (Failures, error) {
+	var failures Failures
+	if err != nil && KeepGoing && errors.As(err, &failures) {
+		return failures, nil
+	}
+	return nil, err
+}
+
+// unitFailures converts the errors joined by forEachOrdered into Failures; ok is false if
+// any of them isn't a unit failure
+func unitFailures(err error) (failures Failures, ok bool) {
+	errs := []error{err}
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		failure, isFailure := e.(*UnitFailure)
+		if !isFailure {
+			return nil, false
+		}
+		failures = append(failures, failure)
+	}
+	return failures, true
+}
+
+// AuthError is a failure to load credentials or to authenticate with ConfigHub
+type AuthError struct {
+	Err error
+}
+
+// Error returns the underlying error message
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// APIError is a ConfigHub API call that returned an unexpected status
+type APIError struct {
+	Op         string // what failed, e.g. "failed to list spaces"
+	StatusCode int
+	Status     string
+}
+
+// Error describes the failed call and its status
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Status)
+}
+
+// apiResponse is the status part of a ConfigHub API response
+type apiResponse interface {
+	StatusCode() int
+	Status() string
+}
+
+// apiError returns the error for a response with an unexpected status
+func apiError(op string, resp apiResponse) error {
+	return &APIError{Op: op, StatusCode: resp.StatusCode(), Status: resp.Status()}
+}
+
+// isAuthFailure reports whether err is (or wraps) an authentication failure
+func isAuthFailure(err error) bool {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
+
+// kindOf returns the kind of a failure, treating rejected credentials as auth failures
+func kindOf(f *UnitFailure) FailureKind {
+	if isAuthFailure(f.Err) {
+		return FailureAuth
+	}
+	return f.Kind
+}
+
+// FailureKindOf returns the most severe kind of failure in err: auth, then sync, then
+// resolve. It returns an empty kind for other errors, such as invalid configs.
+func FailureKindOf(err error) FailureKind {
+	if err == nil {
+		return ""
+	}
+	if isAuthFailure(err) {
+		return FailureAuth
+	}
+
+	found := make(map[FailureKind]bool)
+	var walk func(error)
+	walk = func(err error) {
+		if f, ok := err.(*UnitFailure); ok {
+			found[kindOf(f)] = true
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			if inner := e.Unwrap(); inner != nil {
+				walk(inner)
+			}
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		}
+	}
+	walk(err)
+
+	for _, kind := range []FailureKind{FailureAuth, FailureSync, FailureResolve} {
+		if found[kind] {
+			return kind
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package compose
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// isGlob reports whether a files entry is a pattern rather than a literal file name
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// validateFilePatterns checks that files and exclude entries are well-formed patterns
+func validateFilePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("file patterns must not be empty")
+		}
+		if path.IsAbs(pattern) {
+			return fmt.Errorf("file pattern %q must be relative to dir", pattern)
+		}
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether a slash-separated path matches pattern. Each segment is
+// matched with path.Match, and a "**" segment matches any number of directories.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// expandFiles resolves the files of a unit within root. Literal names are kept as-is, each
+// pattern expands to its matches in lexical order, and entries matching an exclude pattern
+// are dropped. Files are returned in the order they are listed, without duplicates.
+func expandFiles(root *os.Root, files, exclude []string) ([]string, error) {
+	// Only walk the directory if there is a pattern to match
+	var candidates []string
+	if slices.ContainsFunc(files, isGlob) {
+		var err error
+		candidates, err = listPaths(root, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if seen[name] || slices.ContainsFunc(exclude, func(p string) bool { return matchGlob(p, name) }) {
+			return
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+
+	for _, pattern := range files {
+		if !isGlob(pattern) {
+			add(path.Clean(pattern))
+			continue
+		}
+
+		matched := false
+		for _, name := range candidates {
+			if matchGlob(pattern, name) {
+				matched = true
+				add(name)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("pattern %q matched no files", pattern)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("all files are excluded")
+	}
+	return result, nil
+}
+
+// listPaths returns the slash-separated paths of all files (or, with dirs, all directories)
+// under root in lexical order. .git directories are skipped and symlinks are resolved by
+// root, so they can't escape it.
+func listPaths(root *os.Root, dirs bool) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(root.FS(), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		isDir := d.IsDir()
+		if isDir && d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			info, err := root.Stat(name)
+			if err != nil {
+				return nil
+			}
+			isDir = info.IsDir()
+		}
+		if isDir == dirs && name != "." {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	return names, nil
+}
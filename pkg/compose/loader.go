@@ -1,84 +1,355 @@
 package compose
 
 import (
+	"errors"
 	"fmt"
 	"os"
-
-	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/confighub/cub-compose/pkg/config"
 )
 
-// LoadConfig loads and parses a configs.yaml file
-func LoadConfig(path string) (*config.ComposeConfig, error) {
-	data, err := os.ReadFile(path)
+// validateToolchain checks that a toolchain type is known (empty means the default)
+func validateToolchain(toolchain string) error {
+	if toolchain == "" {
+		return nil
+	}
+	names := make([]string, len(config.ToolchainTypes))
+	for i, t := range config.ToolchainTypes {
+		if string(t) == toolchain {
+			return nil
+		}
+		names[i] = string(t)
+	}
+	return fmt.Errorf("unknown toolchain %q (valid: %s)", toolchain, strings.Join(names, ", "))
+}
+
+// LoadConfig loads and merges one or more compose files in order; later files and the files
+// that include others override earlier ones. ${NAME} references are replaced with values
+// from set, the vars sections or the environment, in that order.
+func LoadConfig(paths []string, set map[string]string) (*config.ComposeConfig, error) {
+	cfg, src, err := loadConfigFiles(paths)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
-	var cfg config.ComposeConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if err := interpolateConfig(cfg, set, src); err != nil {
+		return nil, err
 	}
+	mergeInterpolatedRepos(cfg, src)
 
-	if err := validateConfig(&cfg); err != nil {
+	if err := validateConfig(cfg, src); err != nil {
 		return nil, err
 	}
+	recordSources(cfg, src)
+
+	return cfg, nil
+}
 
-	return &cfg, nil
+// validateCommandSettings checks env variable names and the timeout for unit commands
+func validateCommandSettings(env map[string]string, passthrough []string, timeout time.Duration) error {
+	for name := range env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("invalid env variable name %q", name)
+		}
+	}
+	for _, name := range passthrough {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("invalid env-passthrough variable name %q", name)
+		}
+	}
+	if timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
 }
 
-// validateConfig validates the config structure
-func validateConfig(cfg *config.ComposeConfig) error {
+// validateConfig validates the config structure. All problems are reported, each prefixed
+// with the file and line from src where it was declared.
+func validateConfig(cfg *config.ComposeConfig, src *configSource) error {
 	if len(cfg.Configs) == 0 {
-		return fmt.Errorf("no configs defined")
+		return fmt.Errorf("%s: no configs defined", src.top.loc)
+	}
+
+	var errs []error
+	fail := func(loc, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", loc, fmt.Sprintf(format, args...)))
+	}
+
+	if err := validateLabelKeys(cfg.CommonLabels); err != nil {
+		fail(src.top.at("common-labels"), "common-labels: %v", err)
 	}
 
+	// Where each space/unit pair was first declared, to find duplicates across config entries
+	declared := make(map[string]string)
+
 	for i, repo := range cfg.Configs {
-		if repo.Repo == "" {
-			return fmt.Errorf("config[%d]: repo is required", i)
-		}
+		pos := src.repo(i)
 
+		if repo.Repo == "" && repo.Path == "" {
+			fail(pos.loc, "repo or path is required")
+		}
+		if repo.Path != "" && repo.Repo != "" && !isLocalRepo(repo.Repo) {
+			fail(pos.at("path"), "repo and path are mutually exclusive (use --repo-override to redirect a repo)")
+		}
+		if (repo.Path != "" || isLocalRepo(repo.Repo)) && repo.Ref != "" {
+			fail(pos.at("ref"), "ref is not supported for local paths")
+		}
 		if len(repo.Spaces) == 0 {
-			return fmt.Errorf("config[%d]: no spaces defined for repo %s", i, repo.Repo)
+			fail(pos.at("spaces"), "no spaces defined for repo %s", repo.Source())
+		}
+		if err := validateAuth(repo.Auth); err != nil {
+			fail(pos.at("auth"), "auth: %v", err)
+		}
+		if err := validateToolchain(repo.Toolchain); err != nil {
+			fail(pos.at("toolchain"), "%v", err)
+		}
+		if err := validateCommandSettings(repo.Env, repo.EnvPassthrough, repo.Timeout); err != nil {
+			fail(pos.loc, "%v", err)
+		}
+		if err := validateLabelKeys(repo.UnitLabels); err != nil {
+			fail(pos.at("unit-labels"), "unit-labels: %v", err)
 		}
 
-		for spaceName, space := range repo.Spaces {
+		for _, spaceName := range sortedKeys(repo.Spaces) {
+			space := repo.Spaces[spaceName]
+			spacePos := src.space(i, space)
+			fullName := applySpacePrefix(cfg, spaceName)
+			if err := validateSlug(fullName); err != nil {
+				fail(spacePos.loc, "space %s: %v", fullName, err)
+			}
+
 			// Allow empty spaces (no units) - they will be skipped during sync
-			if space == nil || len(space.Units) == 0 {
+			if space == nil {
 				continue
 			}
 
-			for unitName, unit := range space.Units {
+			for _, unitName := range sortedKeys(space.Units) {
+				unit := space.Units[unitName]
+				unitPos := src.unit(i, unit)
+				if unit == nil {
+					fail(unitPos.loc, "unit %s/%s: dir is required", spaceName, unitName)
+					continue
+				}
+
+				key := fullName + "/" + unitName
+				if first, ok := declared[key]; ok {
+					fail(unitPos.loc, "unit %s is already declared at %s", key, first)
+				} else {
+					declared[key] = unitPos.loc
+				}
+
+				if err := validateSlug(unitName); err != nil {
+					fail(unitPos.loc, "unit %s/%s: %v", spaceName, unitName, err)
+				}
 				if unit.Dir == "" {
-					return fmt.Errorf("config[%d]: unit %s/%s: dir is required", i, spaceName, unitName)
+					fail(unitPos.loc, "unit %s/%s: dir is required", spaceName, unitName)
+				}
+				switch {
+				case len(unit.Cmd) == 0 && len(unit.Files) == 0:
+					fail(unitPos.loc, "unit %s/%s: either 'cmd' or 'files' is required", spaceName, unitName)
+				case len(unit.Cmd) > 0 && len(unit.Files) > 0:
+					fail(unitPos.at("files"), "unit %s/%s: 'cmd' and 'files' are mutually exclusive", spaceName, unitName)
+				}
+				if err := validateUnit(unit); err != nil {
+					fail(unitPos.loc, "unit %s/%s: %v", spaceName, unitName, err)
+				}
+			}
+
+			for j, set := range space.UnitSets {
+				if set == nil {
+					continue
 				}
-				if unit.Cmd == "" && len(unit.Files) == 0 {
-					return fmt.Errorf("config[%d]: unit %s/%s: either 'cmd' or 'files' is required", i, spaceName, unitName)
+				if err := validateUnitSet(set); err != nil {
+					fail(src.unitSet(i, set).loc, "space %s: unit-sets[%d]: %v", spaceName, j, err)
 				}
 			}
 		}
 	}
 
+	return errors.Join(errs...)
+}
+
+// slugPattern and labelKeyPattern are the patterns the schema uses for names and label keys,
+// checked again here for names that are interpolated, prefixed or generated by unit-sets
+var (
+	slugPattern     = regexp.MustCompile(config.SlugPattern)
+	labelKeyPattern = regexp.MustCompile(config.LabelKeyPattern)
+)
+
+// validateSlug checks that a space or unit name can be used as a ConfigHub slug
+func validateSlug(name string) error {
+	if !slugPattern.MatchString(name) {
+		err := fmt.Errorf("invalid name %q: %s", name, config.SlugRule)
+		if suggestion := slugify(name); suggestion != "" {
+			err = fmt.Errorf("%w; try %q", err, suggestion)
+		}
+		return err
+	}
 	return nil
 }
 
-// GetAllUnits returns a flat list of all units from the config
-func GetAllUnits(cfg *config.ComposeConfig) []config.ResolvedUnit {
-	var units []config.ResolvedUnit
+// slugify turns name into a valid slug by replacing each run of other characters with
+// '-'; it returns "" if name has no letters or digits
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range name {
+		if r < 0x80 && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return strings.TrimLeft(b.String(), "_-")
+}
+
+// validateLabelKeys checks that label keys are well-formed
+func validateLabelKeys(labels map[string]string) error {
+	for _, key := range sortedKeys(labels) {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid label key %q: %s", key, config.LabelKeyRule)
+		}
+	}
+	return nil
+}
+
+// validateUnit checks the settings of a unit that don't depend on where it is declared
+func validateUnit(unit *config.Unit) error {
+	for _, step := range unit.Cmd {
+		if strings.TrimSpace(step) == "" {
+			return fmt.Errorf("cmd steps must not be empty")
+		}
+	}
+	if err := validateFilePatterns(unit.Files); err != nil {
+		return fmt.Errorf("files: %w", err)
+	}
+	if err := validateFilePatterns(unit.Exclude); err != nil {
+		return fmt.Errorf("exclude: %w", err)
+	}
+	if err := validateToolchain(unit.Toolchain); err != nil {
+		return err
+	}
+	if err := validateLabelKeys(unit.Labels); err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+	return validateCommandSettings(unit.Env, unit.EnvPassthrough, unit.Timeout)
+}
+
+// isLocalRepo reports whether a repo value refers to a local directory rather than a remote
+func isLocalRepo(repo string) bool {
+	return strings.HasPrefix(repo, "file://") ||
+		strings.HasPrefix(repo, "./") || strings.HasPrefix(repo, "../") ||
+		repo == "." || repo == ".." || filepath.IsAbs(repo)
+}
+
+// resolveLocalRepos sets an absolute Path for every repo that refers to a local directory.
+// Relative paths are resolved against baseDir (the directory of the config file).
+func resolveLocalRepos(cfg *config.ComposeConfig, baseDir string) error {
+	for i := range cfg.Configs {
+		repo := &cfg.Configs[i]
+		if repo.Path == "" && isLocalRepo(repo.Repo) {
+			repo.Path = strings.TrimPrefix(repo.Repo, "file://")
+		}
+		if repo.Path == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(repo.Path) {
+			repo.Path = filepath.Join(baseDir, repo.Path)
+		}
+		absPath, err := filepath.Abs(repo.Path)
+		if err != nil {
+			return fmt.Errorf("config[%d]: invalid path %q: %w", i, repo.Path, err)
+		}
+		repo.Path = absPath
+	}
+	return nil
+}
+
+// resolveAuthPaths expands ~ and makes auth file paths relative to baseDir absolute
+func resolveAuthPaths(cfg *config.ComposeConfig, baseDir string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	resolve := func(path string) string {
+		switch {
+		case path == "":
+			return ""
+		case path == "~" || strings.HasPrefix(path, "~/"):
+			return filepath.Join(home, path[1:])
+		case filepath.IsAbs(path):
+			return path
+		default:
+			return filepath.Join(baseDir, path)
+		}
+	}
+
+	for i := range cfg.Configs {
+		if auth := cfg.Configs[i].Auth; auth != nil {
+			auth.SSHKey = resolve(auth.SSHKey)
+			auth.KnownHosts = resolve(auth.KnownHosts)
+		}
+	}
+	return nil
+}
+
+// validateAuth checks repo credentials settings
+func validateAuth(auth *config.RepoAuth) error {
+	if auth == nil {
+		return nil
+	}
+	if auth.TokenEnv != "" && auth.CredentialHelper != "" {
+		return fmt.Errorf("token-env and credential-helper are mutually exclusive")
+	}
+	if auth.Username != "" && auth.TokenEnv == "" {
+		return fmt.Errorf("username requires token-env")
+	}
+	return nil
+}
 
-	for _, repo := range cfg.Configs {
-		for spaceName, space := range repo.Spaces {
-			for unitName, unit := range space.Units {
-				units = append(units, config.ResolvedUnit{
-					RepoURL:   repo.Repo,
-					SpaceName: spaceName,
-					UnitName:  unitName,
-					Dir:       unit.Dir,
-					Cmd:       unit.Cmd,
-				})
+// ApplyRepoOverrides redirects declared repos to local checkouts. Overrides map a repo URL
+// as written in the config to a local directory (relative paths are relative to the working directory).
+func ApplyRepoOverrides(cfg *config.ComposeConfig, overrides map[string]string) error {
+	for repoURL, path := range overrides {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid override path %q: %w", path, err)
+		}
+
+		found := false
+		for i := range cfg.Configs {
+			if cfg.Configs[i].Repo == repoURL {
+				cfg.Configs[i].Path = absPath
+				cfg.Configs[i].Ref = ""
+				found = true
 			}
 		}
+		if !found {
+			return fmt.Errorf("repo %s is not declared in the config", repoURL)
+		}
+	}
+	return nil
+}
+
+// GetAllUnits returns a flat list of all units from the config without resolving content.
+// Names, labels and toolchains are resolved the same way as ResolveUnits.
+func GetAllUnits(cfg *config.ComposeConfig) []config.ResolvedUnit {
+	baseLabels := buildBaseLabels(cfg)
+
+	var units []config.ResolvedUnit
+	for _, job := range collectUnitJobs(cfg) {
+		units = append(units, declareUnit(cfg, &cfg.Configs[job.repoIndex], baseLabels, job))
 	}
 
 	return units
@@ -0,0 +1,59 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"api", "api"},
+		{"my app", "my-app"},
+		{"my  app!", "my-app"},
+		{"team/api.v2", "team-api-v2"},
+		{"_internal", "internal"},
+		{"--api--", "api"},
+		{"snake_case", "snake_case"},
+		{"café", "caf"},
+		{"!!!", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slugify(tt.name); got != tt.want {
+				t.Errorf("slugify(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string // "" if valid
+	}{
+		{"api", ""},
+		{"api-v2_1", ""},
+		{"1st", ""},
+		{"my app", `invalid name "my app": must start with a letter or digit and contain only letters, digits, '-' and '_'; try "my-app"`},
+		{"-api", `try "api"`},
+		{"!!!", `invalid name "!!!"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSlug(tt.name)
+			if tt.err == "" && err != nil {
+				t.Errorf("validateSlug(%q) = %v, want no error", tt.name, err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("validateSlug(%q) = %v, want an error containing %q", tt.name, err, tt.err)
+			}
+		})
+	}
+	if err := validateSlug("!!!"); err != nil && strings.Contains(err.Error(), "try") {
+		t.Errorf("validateSlug(%q) = %v, want no suggestion", "!!!", err)
+	}
+}
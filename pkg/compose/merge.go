@@ -0,0 +1,274 @@
+package compose
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// loadConfigFiles loads each file with its includes and merges them in order. A file
+// reached more than once, through -f or includes, is only merged the first time.
+func loadConfigFiles(paths []string) (*config.ComposeConfig, *configSource, error) {
+	merged := &config.ComposeConfig{}
+	src := newConfigSource()
+	loaded := make(map[string]bool)
+	for _, path := range paths {
+		if err := loadConfigFile(path, nil, loaded, merged, src); err != nil {
+			return nil, nil, err
+		}
+	}
+	return merged, src, nil
+}
+
+// loadConfigFile merges the files included by path into merged, then path itself.
+// stack holds the absolute paths of the files currently being included, to detect cycles;
+// loaded holds those already merged, which are skipped so their unit-sets aren't added twice.
+func loadConfigFile(path string, stack []string, loaded map[string]bool, merged *config.ComposeConfig, src *configSource) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid config path %q: %w", path, err)
+	}
+	if loaded[absPath] {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var doc *yaml.Node
+	if len(root.Content) > 0 {
+		doc = root.Content[0]
+	}
+
+	// The published schema is the source of truth for keys and value types; decodeStrict
+	// backs it up for anything the schema can't express
+	if err := validateSchema(path, doc); err != nil {
+		return err
+	}
+
+	// Unknown keys are errors so that typos aren't silently ignored
+	var cfg config.ComposeConfig
+	if err := decodeStrict(path, data, &cfg); err != nil {
+		return err
+	}
+
+	// Included files come first so the including file can override them
+	_, includeNode := mappingValue(doc, "include")
+	stack = append(stack, absPath)
+	for i, include := range cfg.Include {
+		includePath := include
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), include)
+		}
+		loc := path
+		if includeNode != nil && i < len(includeNode.Content) {
+			loc = location(path, includeNode.Content[i])
+		}
+
+		absInclude, err := filepath.Abs(includePath)
+		if err != nil {
+			return fmt.Errorf("%s: invalid include %q: %w", loc, include, err)
+		}
+		for j, p := range stack {
+			if p == absInclude {
+				cycle := append(append([]string{}, stack[j:]...), absInclude)
+				return fmt.Errorf("%s: include cycle: %s", loc, strings.Join(cycle, " -> "))
+			}
+		}
+
+		if err := loadConfigFile(includePath, stack, loaded, merged, src); err != nil {
+			return fmt.Errorf("%s: include %s: %w", loc, include, err)
+		}
+	}
+	cfg.Include = nil
+
+	// Relative paths in a file are relative to that file
+	if err := resolveLocalRepos(&cfg, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := resolveAuthPaths(&cfg, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	mergeConfig(merged, &cfg, fileSource(path, doc, &cfg), src)
+	loaded[absPath] = true
+	return nil
+}
+
+// repoKey identifies a config entry across files: the same repo (or local path) and ref
+func repoKey(repo *config.RepoConfig) string {
+	source := repo.Repo
+	if repo.Path != "" {
+		source = repo.Path
+	}
+	return source + "\x00" + repo.Ref
+}
+
+// mergeConfig merges override into base docker-compose style: scalars that are set replace
+// the base value, maps are merged key by key, and lists replace the base list. Config entries
+// are matched by repo and ref, spaces and units by name; unmatched ones are added. Refs are
+// matched as written here; mergeInterpolatedRepos merges entries that only match once
+// ${NAME} references are replaced.
+func mergeConfig(base, override *config.ComposeConfig, overrideSrc, src *configSource) {
+	if override.Project != "" {
+		base.Project = override.Project
+	}
+	if override.SpacePrefix != "" {
+		base.SpacePrefix = override.SpacePrefix
+	}
+	base.CommonLabels = mergeMap(base.CommonLabels, override.CommonLabels)
+	base.Vars = mergeMap(base.Vars, override.Vars)
+
+	src.top = src.top.merge(overrideSrc.top)
+	maps.Copy(src.spaces, overrideSrc.spaces)
+	maps.Copy(src.units, overrideSrc.units)
+	maps.Copy(src.sets, overrideSrc.sets)
+
+	for i := range override.Configs {
+		repo := &override.Configs[i]
+		j := -1
+		for k := range base.Configs {
+			if repoKey(&base.Configs[k]) == repoKey(repo) {
+				j = k
+				break
+			}
+		}
+
+		if j < 0 {
+			base.Configs = append(base.Configs, *repo)
+			src.repos = append(src.repos, overrideSrc.repo(i))
+			continue
+		}
+		mergeRepo(&base.Configs[j], repo, overrideSrc, src)
+		src.repos[j] = src.repos[j].merge(overrideSrc.repo(i))
+	}
+}
+
+// mergeInterpolatedRepos merges config entries whose repo and ref match after interpolation,
+// the later entry overriding the earlier one as if both had been written with the same ref
+func mergeInterpolatedRepos(cfg *config.ComposeConfig, src *configSource) {
+	var configs []config.RepoConfig
+	var repos []position
+	for i := range cfg.Configs {
+		repo := &cfg.Configs[i]
+		j := -1
+		for k := range configs {
+			if repoKey(&configs[k]) == repoKey(repo) {
+				j = k
+				break
+			}
+		}
+
+		if j < 0 {
+			configs = append(configs, *repo)
+			repos = append(repos, src.repo(i))
+			continue
+		}
+		mergeRepo(&configs[j], repo, src, src)
+		repos[j] = repos[j].merge(src.repo(i))
+	}
+	cfg.Configs = configs
+	src.repos = repos
+}
+
+// mergeRepo merges an overriding config entry for the same repo and ref into base
+func mergeRepo(base, override *config.RepoConfig, overrideSrc, src *configSource) {
+	if override.Toolchain != "" {
+		base.Toolchain = override.Toolchain
+	}
+	if override.Timeout != 0 {
+		base.Timeout = override.Timeout
+	}
+	if override.Auth != nil {
+		base.Auth = override.Auth
+	}
+	if len(override.EnvPassthrough) > 0 {
+		base.EnvPassthrough = override.EnvPassthrough
+	}
+	base.UnitLabels = mergeMap(base.UnitLabels, override.UnitLabels)
+	base.Env = mergeMap(base.Env, override.Env)
+
+	if base.Spaces == nil {
+		base.Spaces = make(map[string]*config.Space)
+	}
+	for name, space := range override.Spaces {
+		existing := base.Spaces[name]
+		if existing == nil || space == nil {
+			if existing == nil {
+				base.Spaces[name] = space
+			}
+			continue
+		}
+		if p, ok := overrideSrc.spaces[space]; ok {
+			src.spaces[existing] = src.spaces[existing].merge(p)
+		}
+
+		if existing.Units == nil {
+			existing.Units = make(map[string]*config.Unit)
+		}
+		for unitName, unit := range space.Units {
+			if baseUnit := existing.Units[unitName]; baseUnit != nil && unit != nil {
+				mergeUnit(baseUnit, unit)
+				if p, ok := overrideSrc.units[unit]; ok {
+					src.units[baseUnit] = src.units[baseUnit].merge(p)
+				}
+				continue
+			}
+			existing.Units[unitName] = unit
+		}
+		existing.UnitSets = append(existing.UnitSets, space.UnitSets...)
+	}
+}
+
+// mergeUnit merges an overriding unit into base. Setting cmd replaces files and vice versa.
+func mergeUnit(base, override *config.Unit) {
+	if override.Dir != "" {
+		base.Dir = override.Dir
+	}
+	if len(override.Cmd) > 0 {
+		base.Cmd = override.Cmd
+		base.Shell = override.Shell
+		base.Files, base.Exclude = nil, nil
+	}
+	if len(override.Files) > 0 {
+		base.Files = override.Files
+		base.Exclude = override.Exclude
+		base.Cmd, base.Shell = nil, false
+	}
+	if override.Toolchain != "" {
+		base.Toolchain = override.Toolchain
+	}
+	if override.Timeout != 0 {
+		base.Timeout = override.Timeout
+	}
+	if len(override.EnvPassthrough) > 0 {
+		base.EnvPassthrough = override.EnvPassthrough
+	}
+	base.Labels = mergeMap(base.Labels, override.Labels)
+	base.Env = mergeMap(base.Env, override.Env)
+}
+
+// mergeMap returns base with the entries of override added, replacing existing keys
+func mergeMap(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	if base == nil {
+		base = make(map[string]string, len(override))
+	}
+	maps.Copy(base, override)
+	return base
+}
@@ -0,0 +1,293 @@
+package compose
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+func TestMergeUnit(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     config.Unit
+		override config.Unit
+		want     config.Unit
+	}{
+		{
+			name:     "empty override keeps base",
+			base:     config.Unit{Dir: "a", Cmd: config.Command{"kustomize build"}, Timeout: time.Minute},
+			override: config.Unit{},
+			want:     config.Unit{Dir: "a", Cmd: config.Command{"kustomize build"}, Timeout: time.Minute},
+		},
+		{
+			name:     "scalars replace",
+			base:     config.Unit{Dir: "a", Toolchain: "Kubernetes/YAML", Timeout: time.Minute},
+			override: config.Unit{Dir: "b", Toolchain: "AppConfig/Properties", Timeout: time.Second},
+			want:     config.Unit{Dir: "b", Toolchain: "AppConfig/Properties", Timeout: time.Second},
+		},
+		{
+			name:     "maps merge by key",
+			base:     config.Unit{Labels: map[string]string{"A": "1", "B": "1"}, Env: map[string]string{"X": "1"}},
+			override: config.Unit{Labels: map[string]string{"B": "2", "C": "2"}, Env: map[string]string{"Y": "2"}},
+			want:     config.Unit{Labels: map[string]string{"A": "1", "B": "2", "C": "2"}, Env: map[string]string{"X": "1", "Y": "2"}},
+		},
+		{
+			name:     "lists replace",
+			base:     config.Unit{Files: []string{"a.yaml", "b.yaml"}, EnvPassthrough: []string{"HOME", "PATH"}},
+			override: config.Unit{Files: []string{"c.yaml"}, EnvPassthrough: []string{"TOKEN"}},
+			want:     config.Unit{Files: []string{"c.yaml"}, EnvPassthrough: []string{"TOKEN"}},
+		},
+		{
+			name:     "cmd replaces files",
+			base:     config.Unit{Files: []string{"*.yaml"}, Exclude: []string{"x.yaml"}},
+			override: config.Unit{Cmd: config.Command{"echo a | cat"}, Shell: true},
+			want:     config.Unit{Cmd: config.Command{"echo a | cat"}, Shell: true},
+		},
+		{
+			name:     "files replace cmd",
+			base:     config.Unit{Cmd: config.Command{"echo a | cat"}, Shell: true},
+			override: config.Unit{Files: []string{"*.yaml"}, Exclude: []string{"x.yaml"}},
+			want:     config.Unit{Files: []string{"*.yaml"}, Exclude: []string{"x.yaml"}},
+		},
+		{
+			name:     "cmd without shell resets shell",
+			base:     config.Unit{Cmd: config.Command{"echo a | cat"}, Shell: true},
+			override: config.Unit{Cmd: config.Command{"kustomize build"}},
+			want:     config.Unit{Cmd: config.Command{"kustomize build"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeUnit(&tt.base, &tt.override)
+			if !reflect.DeepEqual(tt.base, tt.want) {
+				t.Errorf("mergeUnit = %+v, want %+v", tt.base, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	base := &config.ComposeConfig{
+		Project:      "shop",
+		CommonLabels: map[string]string{"Team": "a", "Tier": "web"},
+		Configs: []config.RepoConfig{{
+			Repo: "https://example.com/app.git", Ref: "main", Toolchain: "Kubernetes/YAML",
+			Spaces: map[string]*config.Space{"dev": {
+				Units:    map[string]*config.Unit{"api": {Dir: "api", Timeout: time.Minute}},
+				UnitSets: []*config.UnitSet{{MatchDirs: "base/*"}},
+			}},
+		}},
+	}
+	override := &config.ComposeConfig{
+		SpacePrefix:  "team-",
+		CommonLabels: map[string]string{"Team": "b"},
+		Configs: []config.RepoConfig{
+			{
+				Repo: "https://example.com/app.git", Ref: "main",
+				Spaces: map[string]*config.Space{
+					"dev": {
+						Units:    map[string]*config.Unit{"api": {Dir: "api/dev"}, "web": {Dir: "web"}},
+						UnitSets: []*config.UnitSet{{MatchDirs: "extra/*"}},
+					},
+					"prod": {Units: map[string]*config.Unit{"api": {Dir: "api/prod"}}},
+				},
+			},
+			{Repo: "https://example.com/app.git", Ref: "v1"},
+		},
+	}
+
+	// The merged source has a position for each entry in base, as built by loadConfigFiles
+	src := newConfigSource()
+	src.repos = make([]position, len(base.Configs))
+	mergeConfig(base, override, newConfigSource(), src)
+
+	if base.Project != "shop" || base.SpacePrefix != "team-" {
+		t.Errorf("project, space-prefix = %q, %q, want unset fields kept", base.Project, base.SpacePrefix)
+	}
+	if want := map[string]string{"Team": "b", "Tier": "web"}; !reflect.DeepEqual(base.CommonLabels, want) {
+		t.Errorf("common-labels = %v, want %v", base.CommonLabels, want)
+	}
+	if len(base.Configs) != 2 || base.Configs[1].Ref != "v1" {
+		t.Fatalf("configs = %+v, want the same repo at another ref added", base.Configs)
+	}
+
+	repo := base.Configs[0]
+	if repo.Toolchain != "Kubernetes/YAML" {
+		t.Errorf("toolchain = %q, want the base value", repo.Toolchain)
+	}
+	dev := repo.Spaces["dev"]
+	if want := (config.Unit{Dir: "api/dev", Timeout: time.Minute}); !reflect.DeepEqual(*dev.Units["api"], want) {
+		t.Errorf("api = %+v, want %+v", *dev.Units["api"], want)
+	}
+	if dev.Units["web"] == nil || repo.Spaces["prod"] == nil {
+		t.Errorf("spaces = %v, want new units and spaces added", repo.Spaces)
+	}
+	if len(dev.UnitSets) != 2 || dev.UnitSets[0].MatchDirs != "base/*" || dev.UnitSets[1].MatchDirs != "extra/*" {
+		t.Errorf("unit-sets = %+v, want base and override unit-sets in order", dev.UnitSets)
+	}
+}
+
+func TestLoadConfigFilesOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		want  string // dir of the unit after merging
+		sets  int    // unit-sets after merging
+	}{
+		{
+			name: "including file overrides includes",
+			files: map[string]string{
+				"base.yaml": unitConfig("base", true),
+				"main.yaml": "include: [base.yaml]\n" + unitConfig("main", false),
+			},
+			args: []string{"main.yaml"},
+			want: "main",
+			sets: 1,
+		},
+		{
+			name: "later includes override earlier ones",
+			files: map[string]string{
+				"a.yaml":    unitConfig("a", true),
+				"b.yaml":    unitConfig("b", false),
+				"main.yaml": "include: [a.yaml, b.yaml]\nconfigs: []\n",
+			},
+			args: []string{"main.yaml"},
+			want: "b",
+			sets: 1,
+		},
+		{
+			name: "later -f files override earlier ones",
+			files: map[string]string{
+				"a.yaml": unitConfig("a", true),
+				"b.yaml": unitConfig("b", false),
+			},
+			args: []string{"a.yaml", "b.yaml"},
+			want: "b",
+			sets: 1,
+		},
+		{
+			name: "diamond include is merged once",
+			files: map[string]string{
+				"common.yaml": unitConfig("common", true),
+				"a.yaml":      "include: [common.yaml]\nconfigs: []\n",
+				"b.yaml":      "include: [common.yaml]\nconfigs: []\n",
+				"main.yaml":   "include: [a.yaml, b.yaml]\nconfigs: []\n",
+			},
+			args: []string{"main.yaml"},
+			want: "common",
+			sets: 1,
+		},
+		{
+			name: "duplicate -f is merged once",
+			files: map[string]string{
+				"a.yaml": unitConfig("a", true),
+			},
+			args: []string{"a.yaml", "a.yaml"},
+			want: "a",
+			sets: 1,
+		},
+		{
+			name: "file included and passed with -f is merged once",
+			files: map[string]string{
+				"common.yaml": unitConfig("common", true),
+				"main.yaml":   "include: [common.yaml]\n" + unitConfig("main", false),
+			},
+			args: []string{"main.yaml", "common.yaml"},
+			want: "main",
+			sets: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(dir, name), content)
+			}
+			var paths []string
+			for _, arg := range tt.args {
+				paths = append(paths, filepath.Join(dir, arg))
+			}
+
+			cfg, _, err := loadConfigFiles(paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.Configs) != 1 {
+				t.Fatalf("configs = %+v, want a single entry", cfg.Configs)
+			}
+			space := cfg.Configs[0].Spaces["dev"]
+			if got := space.Units["api"].Dir; got != tt.want {
+				t.Errorf("dir = %q, want %q", got, tt.want)
+			}
+			if len(space.UnitSets) != tt.sets {
+				t.Errorf("unit-sets = %d, want %d", len(space.UnitSets), tt.sets)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFilesCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), "include: [b.yaml]\nconfigs: []\n")
+	writeFile(t, filepath.Join(dir, "b.yaml"), "include: [a.yaml]\nconfigs: []\n")
+
+	_, _, err := loadConfigFiles([]string{filepath.Join(dir, "a.yaml")})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("err = %v, want an include cycle", err)
+	}
+}
+
+func TestLoadConfigInterpolatedRefs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "base.yaml"), unitConfig("base", true))
+	writeFile(t, filepath.Join(dir, "override.yaml"), "vars:\n  BRANCH: main\n"+
+		strings.Replace(unitConfig("override", false), "ref: main", "ref: ${BRANCH}", 1))
+	paths := []string{filepath.Join(dir, "base.yaml"), filepath.Join(dir, "override.yaml")}
+
+	cfg, err := LoadConfig(paths, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Configs) != 1 {
+		t.Fatalf("configs = %+v, want entries with the same ref after interpolation merged", cfg.Configs)
+	}
+	space := cfg.Configs[0].Spaces["dev"]
+	if got := space.Units["api"].Dir; got != "override" {
+		t.Errorf("dir = %q, want the later entry to override", got)
+	}
+	if len(space.UnitSets) != 1 {
+		t.Errorf("unit-sets = %d, want 1", len(space.UnitSets))
+	}
+
+	// At another ref the entries stay separate, so the unit is declared twice
+	_, err = LoadConfig(paths, map[string]string{"BRANCH": "v1"})
+	if err == nil || !strings.Contains(err.Error(), "unit dev/api is already declared") {
+		t.Errorf("LoadConfig error = %v, want dev/api declared by both entries", err)
+	}
+}
+
+// unitConfig returns a config with unit api in space dev, using dir, and a unit-set if withSet
+func unitConfig(dir string, withSet bool) string {
+	s := `configs:
+- repo: https://example.com/app.git
+  ref: main
+  spaces:
+    dev:
+      units:
+        api:
+          dir: ` + dir + `
+          cmd: kubectl kustomize .
+`
+	if withSet {
+		s += `      unit-sets:
+      - match-dirs: components/*
+        files: ["*.yaml"]
+`
+	}
+	return s
+}
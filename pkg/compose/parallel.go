@@ -0,0 +1,124 @@
+package compose
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Parallel is the maximum number of repos, unit commands or API calls processed at once
+var Parallel = 1
+
+// workerPool bounds concurrency and stops starting new work after the first failure
+type workerPool struct {
+	sem    chan struct{}
+	failed atomic.Bool
+}
+
+// newWorkerPool creates a pool that runs at most size functions at once
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{sem: make(chan struct{}, size)}
+}
+
+// do runs fn once a slot is free; it does nothing if an earlier call has failed,
+// unless KeepGoing is set
+func (p *workerPool) do(fn func() error) error {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+
+	if p.failed.Load() && !KeepGoing {
+		return nil
+	}
+
+	err := fn()
+	if err != nil {
+		p.failed.Store(true)
+	}
+	return err
+}
+
+// orderedOutput buffers the output of concurrent tasks and writes it in task order,
+// flushing each task as soon as it and all tasks before it have finished. Unit results
+// reported by a task are recorded when its output is flushed, so they are in task order too.
+type orderedOutput struct {
+	mu     sync.Mutex
+	report *Reporter
+	tasks  []taskOutput
+	done   []bool
+	next   int
+}
+
+// taskOutput is the buffered output of one task and the unit results it reported
+type taskOutput struct {
+	bytes.Buffer
+	units []UnitResult
+}
+
+// newOrderedOutput creates an ordered output for n tasks, written to report
+func newOrderedOutput(report *Reporter, n int) *orderedOutput {
+	return &orderedOutput{
+		report: report,
+		tasks:  make([]taskOutput, n),
+		done:   make([]bool, n),
+	}
+}
+
+// writer returns the output of task i; it must only be used by that task
+func (o *orderedOutput) writer(i int) io.Writer {
+	return &o.tasks[i]
+}
+
+// finish marks task i as done and flushes any output that is now in order
+func (o *orderedOutput) finish(i int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.done[i] = true
+	for o.next < len(o.done) && o.done[o.next] {
+		task := &o.tasks[o.next]
+		o.report.Writer().Write(task.Bytes())
+		for _, u := range task.units {
+			o.report.addUnit(u)
+		}
+		*task = taskOutput{}
+		o.next++
+	}
+}
+
+// forEachOrdered runs task for each index 0..n-1 with at most Parallel tasks at once.
+// Tasks are started in index order and their output is printed in index order. After
+// the first failure no new tasks are started (unless KeepGoing is set); all errors are
+// returned joined in index order.
+func forEachOrdered(n int, task func(i int, out io.Writer) error) error {
+	pool := newWorkerPool(Parallel)
+	output := newOrderedOutput(Report, n)
+	errs := make([]error, n)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(Parallel, 1), max(n, 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = pool.do(func() error {
+					return task(i, output.writer(i))
+				})
+				output.finish(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForEachOrderedResults(t *testing.T) {
+	for _, parallel := range []int{1, 4, 16} {
+		t.Run(strconv.Itoa(parallel), func(t *testing.T) {
+			var progress bytes.Buffer
+			report := &Reporter{format: OutputJSON, progress: &progress}
+			defer func(r *Reporter, p int) { Report, Parallel = r, p }(Report, Parallel)
+			Report, Parallel = report, parallel
+
+			// Later tasks finish first
+			const n = 8
+			err := forEachOrdered(n, func(i int, out io.Writer) error {
+				time.Sleep(time.Duration(n-i) * time.Millisecond)
+				fmt.Fprintf(out, "task %d\n", i)
+				Report.Unit(out, UnitResult{Space: "dev", Unit: strconv.Itoa(i), Action: ActionUnchanged})
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wantText strings.Builder
+			for i := range n {
+				fmt.Fprintf(&wantText, "task %d\n  = dev/%d unchanged\n", i, i)
+			}
+			if progress.String() != wantText.String() {
+				t.Errorf("output =\n%s\nwant:\n%s", progress.String(), wantText.String())
+			}
+
+			var units []string
+			for _, u := range report.result.Units {
+				units = append(units, u.Unit)
+			}
+			if want := "0 1 2 3 4 5 6 7"; strings.Join(units, " ") != want {
+				t.Errorf("units = %v, want %s", units, want)
+			}
+		})
+	}
+}
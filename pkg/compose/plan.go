@@ -0,0 +1,178 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	pkgconfig "github.com/confighub/cub-compose/pkg/config"
+	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
+)
+
+// UnitAction describes what is done to a unit (or a space) in ConfigHub
+type UnitAction string
+
+const (
+	ActionCreate    UnitAction = "create"
+	ActionUpdate    UnitAction = "update"
+	ActionLabels    UnitAction = "label-only"
+	ActionUnchanged UnitAction = "unchanged"
+	ActionDelete    UnitAction = "delete"
+	ActionSkip      UnitAction = "skip" // not found, nothing to do
+	ActionKeep      UnitAction = "keep" // spaces that down --delete-spaces leaves in place
+)
+
+// UnitPlan describes the planned change for a single unit
+type UnitPlan struct {
+	SpaceName string
+	UnitName  string
+	Action    UnitAction
+	DataDiff  string   // unified diff of Data (empty if unchanged)
+	LabelDiff []string // label changes, one entry per label
+
+	AnnotationDiff []string // source annotation changes, one entry per annotation
+
+	ToolchainDiff string // "old -> new" when the toolchain type changes
+
+	// set for units that exist in ConfigHub
+	spaceID  goclientnew.UUID
+	unitID   goclientnew.UUID
+	revision int64
+}
+
+// Plan contains the changes up would make in ConfigHub
+type Plan struct {
+	NewSpaces []string   // spaces that don't exist yet
+	Units     []UnitPlan // one entry per resolved unit, in input order
+
+	Prune         []UnitPlan // managed units that are no longer declared
+	PruneSpaces   []string   // managed spaces that are no longer declared and will be empty
+	pruneSpaceIDs map[string]goclientnew.UUID
+}
+
+// Count returns the number of units with the given action
+func (p *Plan) Count(action UnitAction) int {
+	n := 0
+	for _, u := range p.Units {
+		if u.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Plan compares resolved units against ConfigHub without making changes.
+// Units are looked up with up to Parallel API calls at once.
+func (s *Syncer) Plan(ctx context.Context, units []pkgconfig.ResolvedUnit) (*Plan, error) {
+	plan := &Plan{}
+
+	// Look up each space once; a nil entry means the space doesn't exist yet
+	spaces := make(map[string]*goclientnew.Space)
+	for _, unit := range units {
+		if _, ok := spaces[unit.SpaceName]; ok {
+			continue
+		}
+		space, err := s.findSpace(ctx, unit.SpaceName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up space %s: %w", unit.SpaceName, err)
+		}
+		spaces[unit.SpaceName] = space
+		if space == nil {
+			plan.NewSpaces = append(plan.NewSpaces, unit.SpaceName)
+		}
+	}
+
+	plan.Units = make([]UnitPlan, len(units))
+	err := forEachOrdered(len(units), func(i int, out io.Writer) error {
+		unit := units[i]
+
+		var existingUnit *goclientnew.Unit
+		if space := spaces[unit.SpaceName]; space != nil {
+			var err error
+			existingUnit, err = s.getUnitBySlug(ctx, space.SpaceID, unit.UnitName)
+			if err != nil {
+				return fmt.Errorf("failed to check unit %s: %w", unit.UnitName, err)
+			}
+		}
+
+		plan.Units[i] = planUnit(existingUnit, unit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// planUnit compares a resolved unit with its existing ConfigHub counterpart (nil if missing)
+func planUnit(existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) UnitPlan {
+	name := unit.SpaceName + "/" + unit.UnitName
+	up := UnitPlan{
+		SpaceName: unit.SpaceName,
+		UnitName:  unit.UnitName,
+	}
+
+	if existingUnit == nil {
+		up.Action = ActionCreate
+		up.DataDiff = unifiedDiff("/dev/null", name+" (configs.yaml)", "", string(unit.Content))
+		up.LabelDiff = labelDiff(nil, unit.Labels)
+		up.AnnotationDiff = labelDiff(nil, sourceAnnotations(unit))
+		return up
+	}
+
+	up.spaceID = existingUnit.SpaceID
+	up.unitID = existingUnit.UnitID
+	up.revision = existingUnit.HeadRevisionNum
+	up.LabelDiff = labelDiff(existingUnit.Labels, mergeLabels(existingUnit.Labels, unit.Labels))
+
+	switch {
+	case dataChanged(existingUnit, unit):
+		up.Action = ActionUpdate
+		up.DataDiff = unifiedDiff(name+" (ConfigHub)", name+" (configs.yaml)", existingUnit.Data, string(unit.Content))
+		if toolchainType := unitToolchain(unit); existingUnit.ToolchainType != toolchainType {
+			up.ToolchainDiff = fmt.Sprintf("%s -> %s", existingUnit.ToolchainType, toolchainType)
+		}
+	case labelsChanged(existingUnit, unit), annotationsChanged(existingUnit, unit):
+		up.Action = ActionLabels
+	default:
+		up.Action = ActionUnchanged
+		return up
+	}
+
+	// Annotations are rewritten, with the current commit, whenever the unit is updated
+	up.AnnotationDiff = labelDiff(existingUnit.Annotations, mergeLabels(existingUnit.Annotations, sourceAnnotations(unit)))
+	return up
+}
+
+// labelDiff describes label changes from existing to desired, sorted by key
+func labelDiff(existing, desired map[string]string) []string {
+	keys := make(map[string]bool)
+	for k := range existing {
+		keys[k] = true
+	}
+	for k := range desired {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var diff []string
+	for _, k := range sorted {
+		oldValue, hadOld := existing[k]
+		newValue, hasNew := desired[k]
+		switch {
+		case !hadOld:
+			diff = append(diff, fmt.Sprintf("+ %s=%s", k, newValue))
+		case !hasNew:
+			diff = append(diff, fmt.Sprintf("- %s=%s", k, oldValue))
+		case oldValue != newValue:
+			diff = append(diff, fmt.Sprintf("~ %s=%s -> %s", k, oldValue, newValue))
+		}
+	}
+	return diff
+}
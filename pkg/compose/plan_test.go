@@ -0,0 +1,111 @@
+package compose
+
+import (
+	"reflect"
+	"testing"
+
+	pkgconfig "github.com/confighub/cub-compose/pkg/config"
+	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
+)
+
+func TestPlanUnit(t *testing.T) {
+	const data = "apiVersion: v1\nkind: ConfigMap\n"
+	existing := func(data string, labels map[string]string) *goclientnew.Unit {
+		return &goclientnew.Unit{Data: data, Labels: labels, ToolchainType: "Kubernetes/YAML"}
+	}
+
+	tests := []struct {
+		name      string
+		existing  *goclientnew.Unit
+		content   string
+		labels    map[string]string
+		action    UnitAction
+		dataDiff  bool
+		labelDiff []string
+	}{
+		{
+			name:      "missing unit is created",
+			content:   data,
+			labels:    map[string]string{"Env": "dev"},
+			action:    ActionCreate,
+			dataDiff:  true,
+			labelDiff: []string{"+ Env=dev"},
+		},
+		{
+			name:     "same data and labels",
+			existing: existing(data, map[string]string{"Env": "dev"}),
+			content:  data,
+			labels:   map[string]string{"Env": "dev"},
+			action:   ActionUnchanged,
+		},
+		{
+			name:     "extra labels in ConfigHub are kept",
+			existing: existing(data, map[string]string{"Env": "dev", "Owner": "ops"}),
+			content:  data,
+			labels:   map[string]string{"Env": "dev"},
+			action:   ActionUnchanged,
+		},
+		{
+			name:      "changed label",
+			existing:  existing(data, map[string]string{"Env": "dev"}),
+			content:   data,
+			labels:    map[string]string{"Env": "prod"},
+			action:    ActionLabels,
+			labelDiff: []string{"~ Env=dev -> prod"},
+		},
+		{
+			name:      "added label",
+			existing:  existing(data, nil),
+			content:   data,
+			labels:    map[string]string{"Env": "dev"},
+			action:    ActionLabels,
+			labelDiff: []string{"+ Env=dev"},
+		},
+		{
+			name:     "changed data",
+			existing: existing(data, nil),
+			content:  data + "metadata:\n  name: app\n",
+			action:   ActionUpdate,
+			dataDiff: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unit := pkgconfig.ResolvedUnit{SpaceName: "dev", UnitName: "app", Labels: tt.labels, Content: []byte(tt.content)}
+			got := planUnit(tt.existing, unit)
+			if got.Action != tt.action {
+				t.Errorf("action = %s, want %s", got.Action, tt.action)
+			}
+			if (got.DataDiff != "") != tt.dataDiff {
+				t.Errorf("data diff = %q, want a diff: %v", got.DataDiff, tt.dataDiff)
+			}
+			if !reflect.DeepEqual(got.LabelDiff, tt.labelDiff) {
+				t.Errorf("label diff = %q, want %q", got.LabelDiff, tt.labelDiff)
+			}
+		})
+	}
+}
+
+func TestLabelDiff(t *testing.T) {
+	tests := []struct {
+		name              string
+		existing, desired map[string]string
+		want              []string
+	}{
+		{"both empty", nil, map[string]string{}, nil},
+		{"same", map[string]string{"A": "1"}, map[string]string{"A": "1"}, nil},
+		{
+			name:     "sorted by key",
+			existing: map[string]string{"B": "1", "C": "1"},
+			desired:  map[string]string{"A": "1", "B": "2"},
+			want:     []string{"+ A=1", "~ B=1 -> 2", "- C=1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labelDiff(tt.existing, tt.desired); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labelDiff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package compose
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups;
+// cancellation kills the command process only
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,119 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	pkgconfig "github.com/confighub/cub-compose/pkg/config"
+	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
+)
+
+// ownerLabel is the label that marks spaces and units as managed by a compose project
+const ownerLabel = "Project"
+
+// PlanPrune adds units and spaces owned by the project but no longer declared to the plan.
+// A unit is owned when its Project label matches; an undeclared owned space is only
+// deleted when all of its units are being pruned.
+func (s *Syncer) PlanPrune(ctx context.Context, plan *Plan, project string, spaces []pkgconfig.ResolvedSpace, units []pkgconfig.ResolvedUnit) error {
+	if project == "" {
+		return fmt.Errorf("pruning requires 'project' to be set in the config (it marks which units are managed)")
+	}
+
+	declaredSpaces := make(map[string]bool)
+	for _, space := range spaces {
+		declaredSpaces[space.Name] = true
+	}
+	declaredUnits := make(map[string]bool)
+	for _, unit := range units {
+		declaredUnits[unit.SpaceName+"/"+unit.UnitName] = true
+	}
+
+	ownerFilter := whereEq(labelAttr(ownerLabel), project)
+	managedSpaces, err := s.listSpaces(ctx, ownerFilter)
+	if err != nil {
+		return fmt.Errorf("failed to list managed spaces: %w", err)
+	}
+	sort.Slice(managedSpaces, func(i, j int) bool {
+		return managedSpaces[i].Slug < managedSpaces[j].Slug
+	})
+
+	for _, space := range managedSpaces {
+		managedUnits, err := s.listUnits(ctx, space.SpaceID, ownerFilter)
+		if err != nil {
+			return fmt.Errorf("failed to list units in space %s: %w", space.Slug, err)
+		}
+		sort.Slice(managedUnits, func(i, j int) bool {
+			return managedUnits[i].Slug < managedUnits[j].Slug
+		})
+
+		pruned := 0
+		for _, unit := range managedUnits {
+			if declaredUnits[space.Slug+"/"+unit.Slug] {
+				continue
+			}
+			plan.Prune = append(plan.Prune, UnitPlan{
+				SpaceName: space.Slug,
+				UnitName:  unit.Slug,
+				Action:    ActionDelete,
+				spaceID:   space.SpaceID,
+				unitID:    unit.UnitID,
+			})
+			pruned++
+		}
+
+		if declaredSpaces[space.Slug] {
+			continue
+		}
+
+		// Only remove the space if nothing unmanaged would be left behind
+		allUnits, err := s.listUnits(ctx, space.SpaceID, nil)
+		if err != nil {
+			return fmt.Errorf("failed to list units in space %s: %w", space.Slug, err)
+		}
+		if len(allUnits) > pruned {
+			continue
+		}
+
+		plan.PruneSpaces = append(plan.PruneSpaces, space.Slug)
+		if plan.pruneSpaceIDs == nil {
+			plan.pruneSpaceIDs = make(map[string]goclientnew.UUID)
+		}
+		plan.pruneSpaceIDs[space.Slug] = space.SpaceID
+	}
+
+	return nil
+}
+
+// Prune deletes the units and spaces listed in the plan's prune section
+func (s *Syncer) Prune(ctx context.Context, plan *Plan) error {
+	out := Report.Writer()
+	for _, unit := range plan.Prune {
+		fmt.Fprintf(out, "Pruning %s/%s...\n", unit.SpaceName, unit.UnitName)
+		result := UnitResult{Space: unit.SpaceName, Unit: unit.UnitName, Action: ActionDelete, UnitID: unit.unitID.String()}
+		err := s.deleteUnit(ctx, unit.spaceID, unit.unitID, unit.UnitName)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		Report.Unit(out, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, spaceName := range plan.PruneSpaces {
+		Report.Printf("Pruning space %s...\n", spaceName)
+		spaceID := plan.pruneSpaceIDs[spaceName]
+		result := SpaceResult{Space: spaceName, Action: ActionDelete, SpaceID: spaceID.String()}
+		err := s.deleteSpace(ctx, spaceID, spaceName)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		Report.Space(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,447 @@
+package compose
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	pkgconfig "github.com/confighub/cub-compose/pkg/config"
+	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
+)
+
+// OutputFormat selects how a command reports its result
+type OutputFormat string
+
+const (
+	OutputText OutputFormat = "text"
+	OutputJSON OutputFormat = "json"
+	OutputYAML OutputFormat = "yaml"
+)
+
+// UnitResult is the outcome for a single unit
+type UnitResult struct {
+	Space          string            `json:"space"`
+	Unit           string            `json:"unit"`
+	Action         UnitAction        `json:"action,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Toolchain      string            `json:"toolchain,omitempty"`
+	ContentHash    string            `json:"contentHash,omitempty"` // sha256 of the resolved content
+	Repo           string            `json:"repo,omitempty"`
+	Commit         string            `json:"commit,omitempty"` // git commit the content was resolved from
+	Dir            string            `json:"dir,omitempty"`
+	UnitID         string            `json:"unitID,omitempty"`   // ConfigHub unit ID
+	Revision       int64             `json:"revision,omitempty"` // ConfigHub head revision
+	Diff           string            `json:"diff,omitempty"`
+	LabelDiff      []string          `json:"labelDiff,omitempty"`
+	AnnotationDiff []string          `json:"annotationDiff,omitempty"`
+	ToolchainDiff  string            `json:"toolchainDiff,omitempty"`
+	Message        string            `json:"message,omitempty"` // why the unit was skipped
+	Error          string            `json:"error,omitempty"`
+}
+
+// SpaceResult is the outcome for a single space
+type SpaceResult struct {
+	Space   string     `json:"space"`
+	Action  UnitAction `json:"action,omitempty"` // create, update, unchanged, delete, keep or skip
+	SpaceID string     `json:"spaceID,omitempty"`
+	Message string     `json:"message,omitempty"` // why the space was kept or skipped
+	Error   string     `json:"error,omitempty"`
+}
+
+// FailureResult is a unit, space or repo that failed in a command run with --keep-going
+type FailureResult struct {
+	Kind  FailureKind `json:"kind"`
+	Space string      `json:"space,omitempty"`
+	Unit  string      `json:"unit,omitempty"`
+	Repo  string      `json:"repo,omitempty"`
+	Error string      `json:"error"`
+}
+
+// Summary counts the results of a command
+type Summary struct {
+	Spaces  int                `json:"spaces"`
+	Units   int                `json:"units"`
+	Actions map[UnitAction]int `json:"actions,omitempty"` // units per action
+	Errors  int                `json:"errors"`
+}
+
+// Result is the document printed by --output json|yaml
+type Result struct {
+	Command  string          `json:"command"`
+	Context  *ContextInfo    `json:"context,omitempty"`
+	Spaces   []SpaceResult   `json:"spaces,omitempty"`
+	Units    []UnitResult    `json:"units,omitempty"`
+	Failures []FailureResult `json:"failures,omitempty"`
+	Data     any             `json:"data,omitempty"` // command-specific results, such as cache entries
+	Summary  Summary         `json:"summary"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Reporter prints the progress of a command and records its results. In text mode progress
+// goes to stdout; in JSON and YAML modes it goes to stderr and the result document is printed
+// to stdout by Finish, so both modes are produced from the same calls.
+type Reporter struct {
+	format   OutputFormat
+	progress io.Writer
+	stdout   io.Writer
+
+	mu      sync.Mutex
+	result  Result
+	printed bool // a command printed its own document with Print
+}
+
+// Report is the reporter used by commands; cmd replaces it according to --output
+var Report = &Reporter{format: OutputText, progress: os.Stdout, stdout: os.Stdout}
+
+// NewReporter creates a reporter for a command in the given format
+func NewReporter(command string, format OutputFormat) (*Reporter, error) {
+	r := &Reporter{format: format, progress: os.Stdout, stdout: os.Stdout, result: Result{Command: command}}
+	switch format {
+	case OutputText:
+	case OutputJSON, OutputYAML:
+		r.progress = os.Stderr
+	default:
+		return nil, fmt.Errorf("invalid output format %q: expected text, json or yaml", format)
+	}
+	return r, nil
+}
+
+// Structured reports whether the result is printed as a JSON or YAML document
+func (r *Reporter) Structured() bool {
+	return r.format != OutputText
+}
+
+// Writer returns the writer for progress output
+func (r *Reporter) Writer() io.Writer {
+	return r.progress
+}
+
+// Printf prints progress output
+func (r *Reporter) Printf(format string, args ...any) {
+	fmt.Fprintf(r.progress, format, args...)
+}
+
+// Println prints a line of progress output
+func (r *Reporter) Println(args ...any) {
+	fmt.Fprintln(r.progress, args...)
+}
+
+// Unit records the result for a unit and prints it to out. Results reported to the output
+// of a task run by forEachOrdered are recorded in task order, when that output is flushed.
+func (r *Reporter) Unit(out io.Writer, u UnitResult) {
+	if task, ok := out.(*taskOutput); ok {
+		task.units = append(task.units, u)
+	} else {
+		r.addUnit(u)
+	}
+	if u.Error != "" {
+		return
+	}
+
+	name := u.Space + "/" + u.Unit
+	switch u.Action {
+	case ActionCreate, ActionUpdate, ActionLabels:
+		fmt.Fprintf(out, "  ✓ %s synced\n", name)
+	case ActionUnchanged:
+		fmt.Fprintf(out, "  = %s unchanged\n", name)
+	case ActionDelete:
+		fmt.Fprintf(out, "  ✓ %s deleted\n", name)
+	case ActionSkip:
+		fmt.Fprintf(out, "  ! %s, skipping\n", u.Message)
+	}
+}
+
+// Space records the result for a space and prints it
+func (r *Reporter) Space(s SpaceResult) {
+	r.mu.Lock()
+	r.result.Spaces = append(r.result.Spaces, s)
+	r.mu.Unlock()
+	if s.Error != "" {
+		return
+	}
+
+	switch s.Action {
+	case ActionCreate:
+		r.Printf("  ✓ space %s created\n", s.Space)
+	case ActionUpdate:
+		r.Printf("  ✓ space %s labels updated\n", s.Space)
+	case ActionUnchanged:
+		if Verbose {
+			r.Printf("  = space %s unchanged\n", s.Space)
+		}
+	case ActionDelete:
+		r.Printf("  ✓ space %s deleted\n", s.Space)
+	case ActionKeep:
+		r.Printf("  ! %s, keeping\n", s.Message)
+	case ActionSkip:
+		r.Printf("  ! %s, skipping\n", s.Message)
+	}
+}
+
+// Failures prints the failures of a command run with --keep-going, grouped by kind
+func (r *Reporter) Failures(failures Failures) {
+	byKind := make(map[FailureKind]Failures)
+	for _, f := range failures {
+		byKind[kindOf(f)] = append(byKind[kindOf(f)], f)
+	}
+
+	r.Printf("\nFailed:\n")
+	for _, kind := range []FailureKind{FailureResolve, FailureSync, FailureAuth} {
+		if len(byKind[kind]) == 0 {
+			continue
+		}
+		r.Printf("  %s (%d):\n", kind, len(byKind[kind]))
+		for _, f := range byKind[kind] {
+			msg := strings.ReplaceAll(f.Error(), "\n", "\n      ")
+			r.Printf("    ! %s\n", msg)
+		}
+	}
+}
+
+// Declared records units without an action, as validate lists them
+func (r *Reporter) Declared(units []pkgconfig.ResolvedUnit) {
+	for _, unit := range units {
+		r.addUnit(resolvedResult(unit))
+	}
+}
+
+// SetContext records the ConfigHub context, as status reports it
+func (r *Reporter) SetContext(info *ContextInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Context = info
+}
+
+// SetData records command-specific results
+func (r *Reporter) SetData(data any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Data = data
+}
+
+// addUnit appends a unit result
+func (r *Reporter) addUnit(u UnitResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Units = append(r.result.Units, u)
+}
+
+// Finish completes the result with a summary and err, and prints the document in JSON and
+// YAML modes. It returns err so commands keep their exit status.
+func (r *Reporter) Finish(err error) error {
+	if !r.Structured() || (r.printed && err == nil) {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := r.result
+	if err != nil {
+		result.Error = err.Error()
+	}
+	var failures Failures
+	if errors.As(err, &failures) {
+		for _, f := range failures {
+			result.Failures = append(result.Failures, FailureResult{Kind: kindOf(f), Space: f.Space, Unit: f.Unit, Repo: f.Repo, Error: f.Error()})
+		}
+	}
+	result.Summary = Summary{Spaces: len(result.Spaces), Units: len(result.Units)}
+	for _, s := range result.Spaces {
+		if s.Error != "" {
+			result.Summary.Errors++
+		}
+	}
+	for _, u := range result.Units {
+		if u.Error != "" {
+			result.Summary.Errors++
+		}
+		if u.Action != "" {
+			if result.Summary.Actions == nil {
+				result.Summary.Actions = make(map[UnitAction]int)
+			}
+			result.Summary.Actions[u.Action]++
+		}
+	}
+
+	if writeErr := r.write(result); writeErr != nil && err == nil {
+		return writeErr
+	}
+	return err
+}
+
+// Print writes v to stdout as JSON, or as YAML in YAML mode, in place of the result
+// document; it is used by commands whose output is a document, such as schema
+func (r *Reporter) Print(v any) error {
+	r.printed = true
+	return r.write(v)
+}
+
+// write writes v to stdout in the output format. YAML is converted from the JSON encoding
+// so that both use the same field names.
+func (r *Reporter) write(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	if r.format == OutputYAML {
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		blockStyle(&node)
+		enc := yaml.NewEncoder(r.stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return fmt.Errorf("failed to encode result: %w", err)
+		}
+		return enc.Close()
+	}
+
+	_, err = fmt.Fprintln(r.stdout, string(data))
+	return err
+}
+
+// blockStyle clears the JSON flow and quoting styles of a decoded node tree, so it is
+// written as block YAML
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// contentHash returns the sha256 of a unit's content
+func contentHash(content []byte) string {
+	if content == nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// resolvedResult describes a resolved unit, before anything is done with it
+func resolvedResult(unit pkgconfig.ResolvedUnit) UnitResult {
+	return UnitResult{
+		Space:       unit.SpaceName,
+		Unit:        unit.UnitName,
+		Labels:      unit.Labels,
+		Toolchain:   unit.Toolchain,
+		ContentHash: contentHash(unit.Content),
+		Repo:        unit.RepoURL,
+		Commit:      unit.Commit,
+		Dir:         unit.Dir,
+	}
+}
+
+// planSymbols maps each action to the marker printed before the unit name
+var planSymbols = map[UnitAction]string{
+	ActionCreate:    "+",
+	ActionUpdate:    "~",
+	ActionLabels:    "~",
+	ActionUnchanged: "=",
+}
+
+// Plan records and prints a plan; units are the resolved units the plan was computed
+// from, in the same order
+func (r *Reporter) Plan(plan *Plan, units []pkgconfig.ResolvedUnit) {
+	for _, space := range plan.NewSpaces {
+		r.mu.Lock()
+		r.result.Spaces = append(r.result.Spaces, SpaceResult{Space: space, Action: ActionCreate})
+		r.mu.Unlock()
+	}
+	for i, u := range plan.Units {
+		result := resolvedResult(units[i])
+		result.Action = u.Action
+		result.Diff = u.DataDiff
+		result.LabelDiff = u.LabelDiff
+		result.AnnotationDiff = u.AnnotationDiff
+		result.ToolchainDiff = u.ToolchainDiff
+		if u.unitID != (goclientnew.UUID{}) {
+			result.UnitID = u.unitID.String()
+			result.Revision = u.revision
+		}
+		r.addUnit(result)
+	}
+	for _, u := range plan.Prune {
+		r.addUnit(UnitResult{Space: u.SpaceName, Unit: u.UnitName, Action: ActionDelete, UnitID: u.unitID.String()})
+	}
+	for _, space := range plan.PruneSpaces {
+		r.mu.Lock()
+		r.result.Spaces = append(r.result.Spaces, SpaceResult{Space: space, Action: ActionDelete, SpaceID: plan.pruneSpaceIDs[space].String()})
+		r.mu.Unlock()
+	}
+
+	r.Println()
+	for _, space := range plan.NewSpaces {
+		r.Printf("+ space %s (create)\n", space)
+	}
+
+	for _, u := range plan.Units {
+		r.Printf("%s %s/%s (%s)\n", planSymbols[u.Action], u.SpaceName, u.UnitName, u.Action)
+		if u.Action == ActionUnchanged {
+			continue
+		}
+
+		if u.ToolchainDiff != "" {
+			r.Printf("  toolchain: %s\n", u.ToolchainDiff)
+		}
+
+		if len(u.LabelDiff) > 0 {
+			r.Println("  labels:")
+			for _, line := range u.LabelDiff {
+				r.Printf("    %s\n", line)
+			}
+		}
+
+		if len(u.AnnotationDiff) > 0 {
+			r.Println("  annotations:")
+			for _, line := range u.AnnotationDiff {
+				r.Printf("    %s\n", line)
+			}
+		}
+
+		if u.DataDiff != "" {
+			for _, line := range strings.Split(strings.TrimSuffix(u.DataDiff, "\n"), "\n") {
+				r.Printf("    %s\n", line)
+			}
+		}
+	}
+
+	r.PrintPrune(plan)
+
+	r.Printf("\nPlan: %d to create, %d to update, %d label-only, %d unchanged, %d to delete",
+		plan.Count(ActionCreate), plan.Count(ActionUpdate),
+		plan.Count(ActionLabels), plan.Count(ActionUnchanged), len(plan.Prune))
+	if len(plan.NewSpaces) > 0 {
+		r.Printf(" (%d new spaces)", len(plan.NewSpaces))
+	}
+	if len(plan.PruneSpaces) > 0 {
+		r.Printf(" (%d spaces to delete)", len(plan.PruneSpaces))
+	}
+	r.Println()
+}
+
+// PrintPrune lists the units and spaces that will be pruned
+func (r *Reporter) PrintPrune(plan *Plan) {
+	if len(plan.Prune) == 0 && len(plan.PruneSpaces) == 0 {
+		return
+	}
+
+	r.Println("\nNo longer declared, will be deleted:")
+	for _, u := range plan.Prune {
+		r.Printf("- %s/%s (%s)\n", u.SpaceName, u.UnitName, u.Action)
+	}
+	for _, space := range plan.PruneSpaces {
+		r.Printf("- space %s (delete)\n", space)
+	}
+}
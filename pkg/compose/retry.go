@@ -0,0 +1,180 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAttemptsEnv     = "CUB_COMPOSE_MAX_ATTEMPTS"
+	defaultMaxAttempts = 4
+
+	// Backoff before the second attempt, doubled for each further attempt up to retryMaxDelay
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+
+	// Longest Retry-After that is honored; longer waits are cut to this
+	maxRetryAfter = time.Minute
+)
+
+// MaxAttempts is the number of times each ConfigHub API call is tried. 0 means
+// $CUB_COMPOSE_MAX_ATTEMPTS, or 4 if that is unset; 1 disables retries.
+var MaxAttempts int
+
+// maxAttempts returns the configured number of attempts per API call
+func maxAttempts() (int, error) {
+	if MaxAttempts > 0 {
+		return MaxAttempts, nil
+	}
+	value := os.Getenv(maxAttemptsEnv)
+	if value == "" {
+		return defaultMaxAttempts, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s %q: expected a number of at least 1", maxAttemptsEnv, value)
+	}
+	return n, nil
+}
+
+// retryTransport retries ConfigHub API calls that fail with a connection error, 429 or a
+// 5xx gateway status, with exponential backoff and jitter. The server's Retry-After is
+// used instead of the backoff when it is given.
+//
+// Retries are only made when they can't apply a change twice: GET, HEAD, PUT and DELETE
+// are retried on any of these failures; POST, which creates spaces and units, only when
+// the connection could not be opened or the server answered 429 or 503 (it was turned away
+// before being processed).
+type retryTransport struct {
+	base        http.RoundTripper
+	maxAttempts int
+}
+
+// newRetryTransport wraps base with retries
+func newRetryTransport(base http.RoundTripper, maxAttempts int) *retryTransport {
+	return &retryTransport{base: base, maxAttempts: maxAttempts}
+}
+
+// RoundTrip sends req, retrying it as described on retryTransport
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A request body can only be sent again if it can be recreated
+	attempts := t.maxAttempts
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if attempt >= attempts || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := backoff(attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if Verbose {
+			Report.Printf("  ! %s %s: %s, retrying in %s (attempt %d of %d)\n",
+				req.Method, req.URL.Path, reason, delay.Round(time.Millisecond), attempt+1, attempts)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a request that got resp or err may be sent again
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	idempotent := false
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		idempotent = true
+	}
+
+	if err != nil {
+		return idempotent || notSent(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// notSent reports whether err happened before the request reached the server, so that
+// even a non-idempotent request can be sent again
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// backoff returns the delay after the given failed attempt: exponential with jitter,
+// between half and all of retryBaseDelay * 2^(attempt-1), capped at retryMaxDelay
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if shift := attempt - 1; shift < 16 {
+		delay = min(retryBaseDelay<<shift, retryMaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryAfter returns the wait requested by a Retry-After header, in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	} else {
+		return 0, false
+	}
+	return min(max(delay, 0), maxRetryAfter), true
+}
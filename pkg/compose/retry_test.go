@@ -0,0 +1,213 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	dnsErr := &net.DNSError{Err: "no such host", Name: "hub.example.com"}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{http.MethodGet, http.StatusOK, nil, false},
+		{http.MethodGet, http.StatusNotFound, nil, false},
+		{http.MethodGet, http.StatusInternalServerError, nil, false},
+		{http.MethodGet, http.StatusTooManyRequests, nil, true},
+		{http.MethodGet, http.StatusBadGateway, nil, true},
+		{http.MethodGet, http.StatusServiceUnavailable, nil, true},
+		{http.MethodGet, http.StatusGatewayTimeout, nil, true},
+		{http.MethodPut, http.StatusBadGateway, nil, true},
+		{http.MethodPut, http.StatusGatewayTimeout, nil, true},
+		{http.MethodDelete, http.StatusBadGateway, nil, true},
+		{http.MethodPost, http.StatusOK, nil, false},
+		{http.MethodPost, http.StatusInternalServerError, nil, false},
+		{http.MethodPost, http.StatusTooManyRequests, nil, true},
+		{http.MethodPost, http.StatusServiceUnavailable, nil, true},
+		{http.MethodPost, http.StatusBadGateway, nil, false},
+		{http.MethodPost, http.StatusGatewayTimeout, nil, false},
+		{http.MethodPatch, http.StatusBadGateway, nil, false},
+		{http.MethodGet, 0, readErr, true},
+		{http.MethodPut, 0, readErr, true},
+		{http.MethodPost, 0, readErr, false},
+		{http.MethodPost, 0, io.ErrUnexpectedEOF, false},
+		{http.MethodPost, 0, dialErr, true},
+		{http.MethodPost, 0, dnsErr, true},
+	}
+	for _, tt := range tests {
+		name := tt.method + " " + strconv.Itoa(tt.status)
+		if tt.err != nil {
+			name = tt.method + " " + tt.err.Error()
+		}
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "https://hub.example.com/api/space", nil)
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := shouldRetry(req, resp, tt.err); got != tt.want {
+				t.Errorf("shouldRetry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "https://hub.example.com/api/space", nil).WithContext(ctx)
+	if shouldRetry(req, &http.Response{StatusCode: http.StatusServiceUnavailable}, nil) {
+		t.Error("shouldRetry = true for a canceled request")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "5", 5 * time.Second, true},
+		{"zero", "0", 0, true},
+		{"negative seconds", "-3", 0, true},
+		{"seconds over the cap", "3600", maxRetryAfter, true},
+		{"http date", now.Add(30 * time.Second).UTC().Format(http.TimeFormat), 30 * time.Second, true},
+		{"past http date", now.Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{"http date over the cap", now.Add(time.Hour).UTC().Format(http.TimeFormat), maxRetryAfter, true},
+		{"invalid", "soon", 0, false},
+		{"fractional seconds", "1.5", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(resp)
+			if ok != tt.ok {
+				t.Fatalf("retryAfter(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+			// HTTP dates have a resolution of one second
+			if diff := got - tt.want; diff < -time.Second || diff > time.Second {
+				t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{6, retryMaxDelay},
+		{100, retryMaxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			for range 100 {
+				if got := backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int // responses in order; the last one repeats
+		want     int   // final status
+		calls    int32
+	}{
+		{"GET retried until success", http.MethodGet, []int{503, 502, 200}, 200, 3},
+		{"PUT retried on 504", http.MethodPut, []int{504, 200}, 200, 2},
+		{"POST retried on 429", http.MethodPost, []int{429, 201}, 201, 2},
+		{"POST not retried on 502", http.MethodPost, []int{502, 201}, 502, 1},
+		{"500 not retried", http.MethodGet, []int{500, 200}, 500, 1},
+		{"gives up after max attempts", http.MethodGet, []int{503}, 503, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != http.MethodGet && string(body) != `{"Slug":"dev"}` {
+					t.Errorf("attempt %d body = %q, want the original body", n, body)
+				}
+				status := tt.statuses[min(n, len(tt.statuses))-1]
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			var body io.Reader
+			if tt.method != http.MethodGet {
+				body = strings.NewReader(`{"Slug":"dev"}`)
+			}
+			req, err := http.NewRequest(tt.method, server.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := newRetryTransport(http.DefaultTransport, 3).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("calls = %d, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryTransportBodyWithoutGetBody(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// A body that can't be recreated is only sent once
+	req, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("{}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newRetryTransport(http.DefaultTransport, 3).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
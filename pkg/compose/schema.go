@@ -0,0 +1,180 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// schemaValidator checks YAML nodes against the configs.yaml JSON Schema
+type schemaValidator struct {
+	path     string
+	defs     map[string]*config.Schema
+	patterns map[string]*regexp.Regexp
+	errs     []error
+}
+
+// validateSchema checks a config file document against config.JSONSchema, reporting every
+// violation with its file and line. Null values are treated as unset, and any scalar is
+// accepted where a string is expected, since YAML decodes unquoted numbers and booleans
+// into string fields as written.
+func validateSchema(path string, doc *yaml.Node) error {
+	if doc == nil {
+		return nil
+	}
+	schema := config.JSONSchema()
+	v := &schemaValidator{path: path, defs: schema.Defs, patterns: make(map[string]*regexp.Regexp)}
+	v.validate(schema, doc, "")
+	return errors.Join(v.errs...)
+}
+
+// fail records a violation at a node
+func (v *schemaValidator) fail(node *yaml.Node, field, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if field != "" {
+		msg = field + ": " + msg
+	}
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", location(v.path, node), msg))
+}
+
+// resolve follows a $ref to its definition
+func (v *schemaValidator) resolve(s *config.Schema) *config.Schema {
+	for s.Ref != "" {
+		s = v.defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+	}
+	return s
+}
+
+// matches reports whether a node is valid against s, without recording violations
+func (v *schemaValidator) matches(s *config.Schema, node *yaml.Node) bool {
+	probe := &schemaValidator{path: v.path, defs: v.defs, patterns: v.patterns}
+	probe.validate(s, node, "")
+	return len(probe.errs) == 0
+}
+
+// validate checks node against s; field is the dotted path of the node for messages
+func (v *schemaValidator) validate(s *config.Schema, node *yaml.Node, field string) {
+	s = v.resolve(s)
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	if len(s.OneOf) > 0 {
+		for _, option := range s.OneOf {
+			if v.matches(option, node) {
+				return
+			}
+		}
+		v.fail(node, field, "must be %s", describeOptions(s.OneOf))
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		if node.Kind != yaml.ScalarNode {
+			v.fail(node, field, "must be a string")
+			return
+		}
+		if s.Pattern != "" && !v.pattern(s.Pattern).MatchString(node.Value) {
+			v.fail(node, field, "invalid value %q", node.Value)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, node.Value) {
+			v.fail(node, field, "unknown value %q (valid: %s)", node.Value, strings.Join(s.Enum, ", "))
+		}
+	case "boolean":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.fail(node, field, "must be true or false")
+		}
+	case "integer":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.fail(node, field, "must be an integer")
+		}
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			v.fail(node, field, "must be a list")
+			return
+		}
+		for i, item := range node.Content {
+			v.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i))
+		}
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			v.fail(node, field, "must be a mapping")
+			return
+		}
+		v.validateObject(s, node, field)
+	}
+}
+
+// validateObject checks the keys and values of a mapping node
+func (v *schemaValidator) validateObject(s *config.Schema, node *yaml.Node, field string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyField := key.Value
+		if field != "" {
+			keyField = field + "." + key.Value
+		}
+		if names := s.PropertyNames; names != nil && !v.pattern(names.Pattern).MatchString(key.Value) {
+			hint := ""
+			if suggestion := slugify(key.Value); suggestion != "" && v.pattern(names.Pattern).MatchString(suggestion) {
+				hint = fmt.Sprintf("; try %q", suggestion)
+			}
+			v.fail(key, field, "invalid name %q: %s%s", key.Value, names.Description, hint)
+		}
+
+		if prop, ok := s.Properties[key.Value]; ok {
+			v.validate(prop, value, keyField)
+			continue
+		}
+		switch additional := s.AdditionalProperties.(type) {
+		case *config.Schema:
+			v.validate(additional, value, keyField)
+		case bool:
+			if !additional {
+				v.fail(key, field, "unknown key %q%s", key.Value, suggestKey(key.Value, s.Properties))
+			}
+		}
+	}
+}
+
+// pattern returns the compiled regular expression for a schema pattern
+func (v *schemaValidator) pattern(expr string) *regexp.Regexp {
+	re, ok := v.patterns[expr]
+	if !ok {
+		re = regexp.MustCompile(expr)
+		v.patterns[expr] = re
+	}
+	return re
+}
+
+// describeOptions describes the types allowed by oneOf schemas, e.g. "a string or a list"
+func describeOptions(options []*config.Schema) string {
+	names := map[string]string{"string": "a string", "array": "a list", "object": "a mapping", "boolean": "true or false", "integer": "an integer"}
+	var parts []string
+	for _, option := range options {
+		parts = append(parts, names[option.Type])
+	}
+	return strings.Join(parts, " or ")
+}
+
+// suggestKey returns a hint naming the known key that key most likely meant, if any
+func suggestKey(key string, properties map[string]*config.Schema) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+	}
+	for _, name := range sortedKeys(properties) {
+		if normalize(name) == normalize(key) {
+			return fmt.Sprintf(" (did you mean %q?)", name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// parseDoc parses a YAML document for validateSchema
+func parseDoc(t *testing.T, data string) *yaml.Node {
+	t.Helper()
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &root); err != nil {
+		t.Fatal(err)
+	}
+	return root.Content[0]
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string // "" if valid
+	}{
+		{"minimal", "configs: []\n", ""},
+		{"unknown key", "configs: []\nextra: 1\n", `configs.yaml:2: unknown key "extra"`},
+		{"misspelled key", "Common_Labels: {}\nconfigs: []\n", `configs.yaml:1: unknown key "Common_Labels" (did you mean "common-labels"?)`},
+		{"wrong type", "configs: {}\n", "configs.yaml:1: configs: must be a list"},
+		{"invalid space name", "configs:\n- repo: x\n  spaces:\n    my app: {units: {}}\n", `configs.yaml:4: configs[0].spaces: invalid name "my app"`},
+		{"space name with a variable", "configs:\n- repo: x\n  spaces:\n    ${ENV}-app: {units: {}}\n", ""},
+		{"invalid label key", "common-labels:\n  -x: y\nconfigs: []\n", `configs.yaml:2: common-labels: invalid name "-x"`},
+		{"repo toolchain", "configs:\n- repo: x\n  toolchain: AppConfig/TOML\n", ""},
+		{"unknown repo toolchain", "configs:\n- repo: x\n  toolchain: Helm\n", `configs.yaml:3: configs[0].toolchain: unknown value "Helm" (valid: Kubernetes/YAML,`},
+		{"unknown unit toolchain", "configs:\n- repo: x\n  spaces:\n    dev:\n      units:\n        api: {dir: ., toolchain: yaml}\n", `configs[0].spaces.dev.units.api.toolchain: unknown value "yaml"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSchema("configs.yaml", parseDoc(t, tt.data))
+			if tt.err == "" && err != nil {
+				t.Errorf("validateSchema = %v, want no error", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("validateSchema = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestToolchainsMatchSchema checks that the schema and LoadConfig accept the same toolchains
+func TestToolchainsMatchSchema(t *testing.T) {
+	toolchains := []string{"", "Helm", "kubernetes/yaml"}
+	for _, tc := range config.ToolchainTypes {
+		toolchains = append(toolchains, string(tc))
+	}
+	for _, toolchain := range toolchains {
+		doc := parseDoc(t, "configs:\n- repo: x\n  toolchain: \""+toolchain+"\"\n")
+		schemaOK := toolchain == "" || validateSchema("configs.yaml", doc) == nil
+		loaderOK := validateToolchain(toolchain) == nil
+		if schemaOK != loaderOK {
+			t.Errorf("toolchain %q: schema accepts it: %v, LoadConfig accepts it: %v", toolchain, schemaOK, loaderOK)
+		}
+	}
+}
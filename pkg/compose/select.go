@@ -0,0 +1,191 @@
+package compose
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// Selection limits a command to some of the declared units. Each field narrows the
+// selection; a unit is selected if it matches any value given for every field that is set.
+type Selection struct {
+	Units  []string          // SPACE or SPACE/UNIT, where both may be glob patterns
+	Spaces []string          // space names or glob patterns
+	Repos  []string          // repo URLs or local paths
+	Labels map[string]string // labels the unit must have, after merging
+}
+
+// ParseSelector parses a label selector of comma-separated KEY=VALUE pairs into labels
+func ParseSelector(selector string, labels map[string]string) error {
+	for _, pair := range strings.Split(selector, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid selector %q: expected KEY=VALUE", pair)
+		}
+		labels[key] = value
+	}
+	return nil
+}
+
+// Validate checks the unit and space patterns of a selection
+func (s *Selection) Validate() error {
+	for _, pattern := range append(append([]string{}, s.Units...), s.Spaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for _, u := range s.Units {
+		if strings.Count(u, "/") > 1 || strings.HasPrefix(u, "/") || strings.HasSuffix(u, "/") {
+			return fmt.Errorf("invalid unit %q: expected SPACE or SPACE/UNIT", u)
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether the selection selects every unit
+func (s *Selection) IsEmpty() bool {
+	return s == nil || (len(s.Units) == 0 && len(s.Spaces) == 0 && len(s.Repos) == 0 && len(s.Labels) == 0)
+}
+
+// String describes the selection for messages
+func (s *Selection) String() string {
+	var parts []string
+	parts = append(parts, s.Units...)
+	for _, space := range s.Spaces {
+		parts = append(parts, "--space "+space)
+	}
+	for _, repo := range s.Repos {
+		parts = append(parts, "--repo "+repo)
+	}
+	for _, k := range sortedKeys(s.Labels) {
+		parts = append(parts, "--selector "+k+"="+s.Labels[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// matchName reports whether a space or unit name matches pattern. Space names may be
+// given with or without the space-prefix.
+func matchName(pattern string, names ...string) bool {
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRepo reports whether a config entry is one of the selected repos
+func (s *Selection) matchRepo(repoCfg *config.RepoConfig) bool {
+	if len(s.Repos) == 0 {
+		return true
+	}
+	for _, repo := range s.Repos {
+		if repo == repoCfg.Repo || repo == repoCfg.Path {
+			return true
+		}
+		if abs, err := filepath.Abs(repo); err == nil && repoCfg.Path != "" && abs == repoCfg.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUnit reports whether a unit is selected; an empty unitName matches any unit of the
+// space, for units that aren't named until their unit-set is expanded
+func (s *Selection) matchUnit(spaceNames []string, unitName string, labels map[string]string) bool {
+	if len(s.Spaces) > 0 {
+		matched := false
+		for _, pattern := range s.Spaces {
+			matched = matched || matchName(pattern, spaceNames...)
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(s.Units) > 0 {
+		matched := false
+		for _, u := range s.Units {
+			spacePattern, unitPattern, hasUnit := strings.Cut(u, "/")
+			if !matchName(spacePattern, spaceNames...) {
+				continue
+			}
+			matched = matched || !hasUnit || unitName == "" || matchName(unitPattern, unitName)
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for k, v := range s.Labels {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter removes the units that aren't selected from cfg, along with unit-sets that can't
+// generate selected units, spaces left empty and configs left without spaces, so that
+// only the repos of selected units are cloned. Unit-sets are kept while their unit names
+// are unknown; filtering again after expanding them removes their unselected units.
+func (s *Selection) Filter(cfg *config.ComposeConfig) {
+	if s.IsEmpty() {
+		return
+	}
+	s.filterUnits(cfg)
+
+	configs := cfg.Configs[:0]
+	for _, repoCfg := range cfg.Configs {
+		if len(repoCfg.Spaces) > 0 {
+			configs = append(configs, repoCfg)
+		}
+	}
+	cfg.Configs = configs
+}
+
+// filterUnits removes unselected units, unit-sets and spaces from each config,
+// keeping the configs themselves in place
+func (s *Selection) filterUnits(cfg *config.ComposeConfig) {
+	if s.IsEmpty() {
+		return
+	}
+	baseLabels := buildBaseLabels(cfg)
+
+	for i := range cfg.Configs {
+		repoCfg := &cfg.Configs[i]
+		if !s.matchRepo(repoCfg) {
+			repoCfg.Spaces = nil
+			continue
+		}
+
+		for spaceName, space := range repoCfg.Spaces {
+			if space == nil {
+				delete(repoCfg.Spaces, spaceName)
+				continue
+			}
+			spaceNames := []string{spaceName, applySpacePrefix(cfg, spaceName)}
+
+			for unitName, unit := range space.Units {
+				if unit == nil || !s.matchUnit(spaceNames, unitName, mergeUnitLabels(baseLabels, repoCfg, unit)) {
+					delete(space.Units, unitName)
+				}
+			}
+
+			var unitSets []*config.UnitSet
+			for _, set := range space.UnitSets {
+				if s.matchUnit(spaceNames, "", mergeUnitLabels(baseLabels, repoCfg, &set.Unit)) {
+					unitSets = append(unitSets, set)
+				}
+			}
+			space.UnitSets = unitSets
+
+			if len(space.Units) == 0 && len(space.UnitSets) == 0 {
+				delete(repoCfg.Spaces, spaceName)
+			}
+		}
+	}
+}
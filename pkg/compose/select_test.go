@@ -0,0 +1,173 @@
+package compose
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     map[string]string
+		err      bool
+	}{
+		{selector: "Env=prod", want: map[string]string{"Env": "prod"}},
+		{selector: "Env=prod, Team=web", want: map[string]string{"Env": "prod", "Team": "web"}},
+		{selector: "Env=", want: map[string]string{"Env": ""}},
+		{selector: "Url=a=b", want: map[string]string{"Url": "a=b"}},
+		{selector: "Env", err: true},
+		{selector: "=prod", err: true},
+		{selector: "Env=prod,", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			labels := make(map[string]string)
+			err := ParseSelector(tt.selector, labels)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseSelector(%q) error = %v, want error: %v", tt.selector, err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(labels, tt.want) {
+				t.Errorf("ParseSelector(%q) = %v, want %v", tt.selector, labels, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		sel  Selection
+		err  string
+	}{
+		{"empty", Selection{}, ""},
+		{"space and unit", Selection{Units: []string{"dev", "dev/api", "*/api-*"}, Spaces: []string{"prod-*"}}, ""},
+		{"bad pattern", Selection{Spaces: []string{"dev["}}, "invalid pattern"},
+		{"bad unit pattern", Selection{Units: []string{"dev/[a"}}, "invalid pattern"},
+		{"too many slashes", Selection{Units: []string{"dev/api/x"}}, "expected SPACE or SPACE/UNIT"},
+		{"leading slash", Selection{Units: []string{"/api"}}, "expected SPACE or SPACE/UNIT"},
+		{"trailing slash", Selection{Units: []string{"dev/"}}, "expected SPACE or SPACE/UNIT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sel.Validate()
+			if tt.err == "" && err != nil {
+				t.Errorf("Validate() = %v, want no error", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSelectionMatchUnit(t *testing.T) {
+	// Space dev with space-prefix team-
+	spaceNames := []string{"dev", "team-dev"}
+	labels := map[string]string{"Env": "dev", "Team": "web"}
+
+	tests := []struct {
+		name string
+		sel  Selection
+		unit string
+		want bool
+	}{
+		{"empty selection", Selection{}, "api", true},
+		{"space", Selection{Spaces: []string{"dev"}}, "api", true},
+		{"space with prefix", Selection{Spaces: []string{"team-dev"}}, "api", true},
+		{"space glob", Selection{Spaces: []string{"d*"}}, "api", true},
+		{"other space", Selection{Spaces: []string{"prod"}}, "api", false},
+		{"any of several spaces", Selection{Spaces: []string{"prod", "dev"}}, "api", true},
+		{"unit", Selection{Units: []string{"dev/api"}}, "api", true},
+		{"unit glob", Selection{Units: []string{"*/a*"}}, "api", true},
+		{"other unit", Selection{Units: []string{"dev/web"}}, "api", false},
+		{"whole space as unit", Selection{Units: []string{"dev"}}, "api", true},
+		{"unit in other space", Selection{Units: []string{"prod/api"}}, "api", false},
+		{"unknown unit name of a unit-set", Selection{Units: []string{"dev/web"}}, "", true},
+		{"label", Selection{Labels: map[string]string{"Env": "dev"}}, "api", true},
+		{"all labels must match", Selection{Labels: map[string]string{"Env": "dev", "Team": "db"}}, "api", false},
+		{"missing label", Selection{Labels: map[string]string{"Owner": ""}}, "api", false},
+		{"every field must match", Selection{Spaces: []string{"dev"}, Units: []string{"dev/web"}}, "api", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sel.matchUnit(spaceNames, tt.unit, labels); got != tt.want {
+				t.Errorf("matchUnit(%q) = %v, want %v", tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectionMatchRepo(t *testing.T) {
+	remote := &config.RepoConfig{Repo: "https://example.com/app.git"}
+	tests := []struct {
+		name  string
+		repos []string
+		want  bool
+	}{
+		{"no repos", nil, true},
+		{"same url", []string{"https://example.com/app.git"}, true},
+		{"other url", []string{"https://example.com/other.git"}, false},
+		{"any of several", []string{"https://example.com/other.git", "https://example.com/app.git"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel := &Selection{Repos: tt.repos}
+			if got := sel.matchRepo(remote); got != tt.want {
+				t.Errorf("matchRepo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	local := &config.RepoConfig{Path: dir}
+	if !(&Selection{Repos: []string{dir}}).matchRepo(local) {
+		t.Errorf("matchRepo(%q) = false for the same local path", dir)
+	}
+}
+
+func TestSelectionFilter(t *testing.T) {
+	cfg := &config.ComposeConfig{
+		Configs: []config.RepoConfig{
+			{
+				Repo: "https://example.com/app.git",
+				Spaces: map[string]*config.Space{
+					"dev": {
+						Units:    map[string]*config.Unit{"api": {Dir: "api"}, "web": {Dir: "web"}},
+						UnitSets: []*config.UnitSet{{MatchDirs: "svc/*"}},
+					},
+					"prod": {Units: map[string]*config.Unit{"api": {Dir: "api"}}},
+				},
+			},
+			{
+				Repo:   "https://example.com/other.git",
+				Spaces: map[string]*config.Space{"prod": {Units: map[string]*config.Unit{"db": {Dir: "db"}}}},
+			},
+		},
+	}
+
+	(&Selection{Units: []string{"dev/api"}}).Filter(cfg)
+
+	if len(cfg.Configs) != 1 {
+		t.Fatalf("configs = %d, want the config without selected units removed", len(cfg.Configs))
+	}
+	spaces := cfg.Configs[0].Spaces
+	if len(spaces) != 1 || spaces["dev"] == nil {
+		t.Fatalf("spaces = %v, want only dev", spaces)
+	}
+	var units []string
+	for name := range spaces["dev"].Units {
+		units = append(units, name)
+	}
+	sort.Strings(units)
+	if !reflect.DeepEqual(units, []string{"api"}) {
+		t.Errorf("units = %v, want [api]", units)
+	}
+	// Unit-sets may still generate dev/api, so they are kept until they are expanded
+	if len(spaces["dev"].UnitSets) != 1 {
+		t.Errorf("unit-sets = %d, want 1", len(spaces["dev"].UnitSets))
+	}
+}
@@ -0,0 +1,82 @@
+package compose
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shellOperators are characters with special meaning to a shell that splitCommand won't interpret
+const shellOperators = "|&;<>()$`"
+
+// splitCommand splits a command line into arguments using POSIX shell quoting rules:
+// single quotes preserve everything literally, double quotes allow \" \\ \$ \` escapes,
+// and a backslash outside quotes escapes the next character. Pipes, redirects, variables
+// and command substitution are rejected since they require a shell (use shell: true).
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing backslash in %q", s)
+			}
+			i++
+			// Backslash-newline is a line continuation
+			if s[i] != '\n' {
+				arg.WriteByte(s[i])
+				inArg = true
+			}
+
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			arg.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				switch {
+				case s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0:
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				case s[i] == '$' || s[i] == '`':
+					return nil, fmt.Errorf("%q in %q requires shell: true", s[i], s)
+				}
+				arg.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated double quote in %q", s)
+			}
+			inArg = true
+
+		case strings.IndexByte(shellOperators, c) >= 0:
+			return nil, fmt.Errorf("unquoted %q in %q requires shell: true", c, s)
+
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
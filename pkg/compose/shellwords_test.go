@@ -0,0 +1,80 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"blank", " \t\n ", nil},
+		{"words", "kubectl kustomize .", []string{"kubectl", "kustomize", "."}},
+		{"extra whitespace", "  helm\ttemplate \n app  ", []string{"helm", "template", "app"}},
+		{"single quotes", `echo 'a b' 'c"d'`, []string{"echo", "a b", `c"d`}},
+		{"single quotes keep backslash and dollar", `echo '\n $HOME'`, []string{"echo", `\n $HOME`}},
+		{"empty single quotes", `echo ''`, []string{"echo", ""}},
+		{"double quotes", `echo "a b" "it's"`, []string{"echo", "a b", "it's"}},
+		{"empty double quotes", `echo ""`, []string{"echo", ""}},
+		{"double quote escapes", "echo \"\\\" \\\\ \\$ \\`\"", []string{"echo", "\" \\ $ `"}},
+		{"double quotes keep other backslashes", `echo "a\nb"`, []string{"echo", `a\nb`}},
+		{"double quote line continuation", "echo \"a\\\nb\"", []string{"echo", "ab"}},
+		{"backslash escapes", `echo a\ b \'c\' \|`, []string{"echo", "a b", "'c'", "|"}},
+		{"line continuation", "kubectl \\\n kustomize", []string{"kubectl", "kustomize"}},
+		{"adjacent quoting joins", `--set=a'b c'"d e"f`, []string{"--set=ab cd ef"}},
+		{"operators in quotes", `grep 'a|b' "c;d"`, []string{"grep", "a|b", "c;d"}},
+		{"single-quoted ${", `echo '${IMAGE}'`, []string{"echo", "${IMAGE}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.in)
+			if err != nil {
+				t.Fatalf("splitCommand(%q) failed: %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCommandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"trailing backslash", `echo a\`, "trailing backslash"},
+		{"unterminated single quote", `echo 'a`, "unterminated single quote"},
+		{"unterminated double quote", `echo "a`, "unterminated double quote"},
+		{"pipe", "kustomize . | kubectl apply -f -", `unquoted '|' in`},
+		{"redirect", "echo a > out", `unquoted '>' in`},
+		{"and", "make && make install", `unquoted '&' in`},
+		{"semicolon", "a; b", `unquoted ';' in`},
+		{"subshell", "(cd x)", `unquoted '(' in`},
+		{"variable", "echo $HOME", `unquoted '$' in`},
+		{"braced variable", "echo ${HOME}", `unquoted '$' in`},
+		{"backtick", "echo `date`", "unquoted '`' in"},
+		{"variable in double quotes", `echo "$HOME"`, `'$' in`},
+		{"command substitution in double quotes", "echo \"`date`\"", "'`' in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.in)
+			if err == nil {
+				t.Fatalf("splitCommand(%q) = %q, want error containing %q", tt.in, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("splitCommand(%q) error = %q, want it to contain %q", tt.in, err, tt.want)
+			}
+			if strings.Contains(tt.want, " in") && !strings.Contains(err.Error(), "requires shell: true") {
+				t.Errorf("splitCommand(%q) error = %q, want a hint to use shell: true", tt.in, err)
+			}
+		})
+	}
+}
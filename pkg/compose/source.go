@@ -0,0 +1,230 @@
+package compose
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// position is where a mapping was declared in a config file, and where each of its keys is
+type position struct {
+	loc    string            // file:line of the mapping (or of its key in the parent)
+	fields map[string]string // file:line of each key of the mapping
+}
+
+// at returns the location of a key of the mapping, falling back to the mapping itself
+func (p position) at(field string) string {
+	if loc, ok := p.fields[field]; ok {
+		return loc
+	}
+	return p.loc
+}
+
+// merge returns p updated with the locations of an overriding mapping
+func (p position) merge(override position) position {
+	fields := make(map[string]string, len(p.fields)+len(override.fields))
+	maps.Copy(fields, p.fields)
+	maps.Copy(fields, override.fields)
+	return position{loc: override.loc, fields: fields}
+}
+
+// newPosition records the location of a mapping node and its keys. keyNode is the node
+// of the mapping's key in its parent, used as the mapping location if given.
+func newPosition(path string, keyNode, node *yaml.Node) position {
+	p := position{fields: make(map[string]string)}
+	switch {
+	case keyNode != nil:
+		p.loc = location(path, keyNode)
+	case node != nil:
+		p.loc = location(path, node)
+	default:
+		p.loc = path
+	}
+	if node != nil && node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			p.fields[node.Content[i].Value] = location(path, node.Content[i])
+		}
+	}
+	return p
+}
+
+// configSource records the file and line where each part of a merged config was declared
+type configSource struct {
+	top    position   // top-level keys
+	repos  []position // each config entry, by index
+	spaces map[*config.Space]position
+	units  map[*config.Unit]position
+	sets   map[*config.UnitSet]position
+}
+
+// newConfigSource creates an empty source map
+func newConfigSource() *configSource {
+	return &configSource{
+		spaces: make(map[*config.Space]position),
+		units:  make(map[*config.Unit]position),
+		sets:   make(map[*config.UnitSet]position),
+	}
+}
+
+// repo returns the position of config entry i, falling back to "config[i]" if it isn't known
+func (s *configSource) repo(i int) position {
+	if i < len(s.repos) && s.repos[i].loc != "" {
+		return s.repos[i]
+	}
+	return position{loc: fmt.Sprintf("config[%d]", i)}
+}
+
+// space returns the position of a space, falling back to its config entry
+func (s *configSource) space(i int, space *config.Space) position {
+	if p, ok := s.spaces[space]; ok && space != nil {
+		return p
+	}
+	return s.repo(i)
+}
+
+// unit returns the position of a unit, falling back to its config entry
+func (s *configSource) unit(i int, unit *config.Unit) position {
+	if p, ok := s.units[unit]; ok {
+		return p
+	}
+	return s.repo(i)
+}
+
+// unitSet returns the position of a unit-set, falling back to its config entry
+func (s *configSource) unitSet(i int, set *config.UnitSet) position {
+	if p, ok := s.sets[set]; ok {
+		return p
+	}
+	return s.repo(i)
+}
+
+// recordSources sets the Source of each unit and unit-set to where it was declared, for
+// errors found once the config is loaded, such as duplicate names generated by unit-sets
+func recordSources(cfg *config.ComposeConfig, src *configSource) {
+	for i, repo := range cfg.Configs {
+		for _, space := range repo.Spaces {
+			if space == nil {
+				continue
+			}
+			for _, unit := range space.Units {
+				if unit != nil {
+					unit.Source = src.unit(i, unit).loc
+				}
+			}
+			for _, set := range space.UnitSets {
+				if set != nil {
+					set.Source = src.unitSet(i, set).loc
+				}
+			}
+		}
+	}
+}
+
+// location formats the position of a YAML node in a file
+func location(path string, node *yaml.Node) string {
+	return fmt.Sprintf("%s:%d", path, node.Line)
+}
+
+// mappingValue returns the key and value nodes of key in a mapping node, or nil if absent
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// yamlLinePrefix matches the "line N: " prefix of yaml.v3 error messages
+var yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// decodeStrict decodes a config file, rejecting unknown keys. Errors are reported as
+// "path:line: message", one per line.
+func decodeStrict(path string, data []byte, cfg *config.ComposeConfig) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err := decoder.Decode(cfg)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	for i, msg := range msgs {
+		if m := yamlLinePrefix.FindStringSubmatch(msg); m != nil {
+			msgs[i] = fmt.Sprintf("%s:%s: %s", path, m[1], msg[len(m[0]):])
+		} else {
+			msgs[i] = fmt.Sprintf("%s: %s", path, msg)
+		}
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// fileSource records the positions of the top-level keys, config entries, spaces, units
+// and unit-sets of a single file
+func fileSource(path string, doc *yaml.Node, cfg *config.ComposeConfig) *configSource {
+	src := newConfigSource()
+	src.top = newPosition(path, nil, doc)
+	src.repos = make([]position, len(cfg.Configs))
+
+	_, configsNode := mappingValue(doc, "configs")
+	if configsNode == nil || configsNode.Kind != yaml.SequenceNode {
+		return src
+	}
+
+	for i, item := range configsNode.Content {
+		if i >= len(cfg.Configs) {
+			break
+		}
+		src.repos[i] = newPosition(path, nil, item)
+
+		_, spacesNode := mappingValue(item, "spaces")
+		if spacesNode == nil || spacesNode.Kind != yaml.MappingNode {
+			continue
+		}
+		for k := 0; k+1 < len(spacesNode.Content); k += 2 {
+			spaceKey, spaceNode := spacesNode.Content[k], spacesNode.Content[k+1]
+			space := cfg.Configs[i].Spaces[spaceKey.Value]
+			if space == nil {
+				continue
+			}
+			src.spaces[space] = newPosition(path, spaceKey, spaceNode)
+
+			_, unitsNode := mappingValue(spaceNode, "units")
+			if unitsNode != nil && unitsNode.Kind == yaml.MappingNode {
+				for u := 0; u+1 < len(unitsNode.Content); u += 2 {
+					if unit := space.Units[unitsNode.Content[u].Value]; unit != nil {
+						src.units[unit] = newPosition(path, unitsNode.Content[u], unitsNode.Content[u+1])
+					}
+				}
+			}
+
+			_, setsNode := mappingValue(spaceNode, "unit-sets")
+			if setsNode != nil && setsNode.Kind == yaml.SequenceNode {
+				for j, setNode := range setsNode.Content {
+					if j < len(space.UnitSets) && space.UnitSets[j] != nil {
+						src.sets[space.UnitSets[j]] = newPosition(path, nil, setNode)
+					}
+				}
+			}
+		}
+	}
+	return src
+}
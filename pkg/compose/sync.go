@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,12 +15,20 @@ import (
 
 	pkgconfig "github.com/confighub/cub-compose/pkg/config"
 	goclientnew "github.com/confighub/sdk/openapi/goclient-new"
-	"github.com/confighub/sdk/workerapi"
 )
 
 const (
 	configHubDir     = ".confighub"
 	defaultServerURL = "https://hub.confighub.com"
+
+	// createdByLabel marks spaces created by cub-compose so down can remove them
+	createdByLabel = "CreatedBy"
+	createdByValue = "cub-compose"
+
+	// Annotations recording the git source of each unit's content
+	gitRepoAnnotation   = "GitRepo"
+	gitCommitAnnotation = "GitCommit"
+	gitDirAnnotation    = "GitDir"
 )
 
 // mergeLabels merges existing labels with new labels (new takes precedence)
@@ -33,6 +43,21 @@ func mergeLabels(existing, new map[string]string) map[string]string {
 	return merged
 }
 
+// sourceAnnotations returns annotations recording the git source of a unit's content
+func sourceAnnotations(unit pkgconfig.ResolvedUnit) map[string]string {
+	annotations := make(map[string]string)
+	if unit.RepoURL != "" {
+		annotations[gitRepoAnnotation] = unit.RepoURL
+	}
+	if unit.Commit != "" {
+		annotations[gitCommitAnnotation] = unit.Commit
+	}
+	if unit.Dir != "" {
+		annotations[gitDirAnnotation] = unit.Dir
+	}
+	return annotations
+}
+
 // resolveTokenPath resolves a token file path, handling ~ prefix like the SDK does
 func resolveTokenPath(home, tokenFile string) string {
 	if filepath.IsAbs(tokenFile) {
@@ -88,10 +113,10 @@ type TokenData struct {
 
 // ContextInfo contains information about the current context
 type ContextInfo struct {
-	ContextName      string
-	ServerURL        string
-	OrganizationName string
-	User             string
+	ContextName      string `json:"context"`
+	ServerURL        string `json:"server"`
+	OrganizationName string `json:"organization"`
+	User             string `json:"user"`
 }
 
 // GetContextInfo loads and returns the current context information
@@ -155,20 +180,53 @@ type Syncer struct {
 
 // NewSyncer creates a new syncer using the cub CLI credentials
 func NewSyncer() (*Syncer, error) {
+	serverURL, token, err := loadCredentials()
+	if err != nil {
+		return nil, &AuthError{Err: err}
+	}
+
+	attempts, err := maxAttempts()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := goclientnew.NewClientWithResponses(serverURL+"/api", func(c *goclientnew.Client) error {
+		// Retry transient failures such as 503s, rate limits and connection resets
+		c.Client = &http.Client{Transport: newRetryTransport(http.DefaultTransport, attempts)}
+		c.RequestEditors = append(c.RequestEditors, func(ctx context.Context, req *http.Request) error {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+			return nil
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API client: %w", err)
+	}
+
+	return &Syncer{
+		client:    client,
+		serverURL: serverURL,
+	}, nil
+}
+
+// loadCredentials reads the server URL and token of the current cub CLI context
+func loadCredentials() (string, TokenData, error) {
+	var token TokenData
+
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return "", token, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	configPath := filepath.Join(home, configHubDir, "config.yaml")
 	configData, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read cub config (run 'cub auth login' first): %w", err)
+		return "", token, fmt.Errorf("failed to read cub config (run 'cub auth login' first): %w", err)
 	}
 
 	var config CubConfig
 	if err := yaml.Unmarshal(configData, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse cub config: %w", err)
+		return "", token, fmt.Errorf("failed to parse cub config: %w", err)
 	}
 
 	// Find the current context
@@ -180,42 +238,25 @@ func NewSyncer() (*Syncer, error) {
 		}
 	}
 	if currentCtx == nil {
-		return nil, fmt.Errorf("current context %q not found in config", config.CurrentContext)
+		return "", token, fmt.Errorf("current context %q not found in config", config.CurrentContext)
 	}
 
 	// Load the token - handle ~ prefix like the SDK does
 	tokenPath := resolveTokenPath(home, currentCtx.Metadata.TokenFile)
 	tokenData, err := os.ReadFile(tokenPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read token (run 'cub auth login' first): %w", err)
+		return "", token, fmt.Errorf("failed to read token (run 'cub auth login' first): %w", err)
 	}
 
-	var token TokenData
 	if err := json.Unmarshal(tokenData, &token); err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return "", token, fmt.Errorf("failed to parse token: %w", err)
 	}
 
-	// Create the API client
 	serverURL := currentCtx.Coordinate.ServerURL
 	if serverURL == "" {
 		serverURL = defaultServerURL
 	}
-
-	client, err := goclientnew.NewClientWithResponses(serverURL+"/api", func(c *goclientnew.Client) error {
-		c.RequestEditors = append(c.RequestEditors, func(ctx context.Context, req *http.Request) error {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
-			return nil
-		})
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create API client: %w", err)
-	}
-
-	return &Syncer{
-		client:    client,
-		serverURL: serverURL,
-	}, nil
+	return serverURL, token, nil
 }
 
 // TestConnection tests the API connection by listing spaces
@@ -226,59 +267,117 @@ func (s *Syncer) TestConnection(ctx context.Context) error {
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("unexpected status: %s", resp.Status())
+		return apiError("unexpected status", resp)
 	}
 
 	return nil
 }
 
-// SyncUp creates or updates spaces and units in ConfigHub
+// SyncUp creates or updates spaces and units in ConfigHub.
+// Spaces are ensured first; units are then synced with up to Parallel API calls at once.
 func (s *Syncer) SyncUp(ctx context.Context, spaces []pkgconfig.ResolvedSpace, units []pkgconfig.ResolvedUnit) error {
-	// Cache space IDs to avoid redundant lookups/creates
-	spaceCache := make(map[string]goclientnew.UUID)
-
 	// Build a map of space labels for quick lookup
 	spaceLabels := make(map[string]map[string]string)
 	for _, space := range spaces {
 		spaceLabels[space.Name] = space.Labels
 	}
 
+	// Get or create each space once, in order of first use. With KeepGoing, a space that
+	// can't be ensured fails its units and the other spaces are still synced.
+	spaceIDs := make(map[string]goclientnew.UUID)
+	var failures Failures
+	failedSpaces := make(map[string]bool)
 	for _, unit := range units {
-		fmt.Printf("Syncing %s/%s...\n", unit.SpaceName, unit.UnitName)
-
-		// Get or create the space
-		spaceID, ok := spaceCache[unit.SpaceName]
-		if !ok {
-			var err error
-			labels := spaceLabels[unit.SpaceName]
-			spaceID, err = s.ensureSpace(ctx, unit.SpaceName, labels)
-			if err != nil {
-				return fmt.Errorf("failed to ensure space %s: %w", unit.SpaceName, err)
-			}
-			spaceCache[unit.SpaceName] = spaceID
+		if _, ok := spaceIDs[unit.SpaceName]; ok || failedSpaces[unit.SpaceName] {
+			continue
 		}
-
-		// Check if unit exists
-		existingUnit, err := s.getUnitBySlug(ctx, spaceID, unit.UnitName)
+		spaceID, err := s.ensureSpace(ctx, unit.SpaceName, spaceLabels[unit.SpaceName])
 		if err != nil {
-			return fmt.Errorf("failed to check unit %s: %w", unit.UnitName, err)
+			err = fmt.Errorf("failed to ensure space %s: %w", unit.SpaceName, err)
+			Report.Space(SpaceResult{Space: unit.SpaceName, Error: err.Error()})
+			failure := &UnitFailure{Kind: FailureSync, Space: unit.SpaceName, Err: err}
+			if !KeepGoing {
+				return failure
+			}
+			failures = append(failures, failure)
+			failedSpaces[unit.SpaceName] = true
+			continue
 		}
+		spaceIDs[unit.SpaceName] = spaceID
+	}
 
-		if existingUnit != nil {
-			// Update existing unit (merges labels with existing)
-			err = s.updateUnit(ctx, spaceID, existingUnit.UnitID, existingUnit, unit)
-		} else {
-			// Create new unit
-			err = s.createUnit(ctx, spaceID, unit)
+	err := forEachOrdered(len(units), func(i int, out io.Writer) error {
+		unit := units[i]
+		if failedSpaces[unit.SpaceName] {
+			return nil
 		}
+		spaceID := spaceIDs[unit.SpaceName]
 
+		fmt.Fprintf(out, "Syncing %s/%s...\n", unit.SpaceName, unit.UnitName)
+
+		result := resolvedResult(unit)
+		err := s.syncUnit(ctx, spaceID, unit, &result)
 		if err != nil {
+			result.Error = err.Error()
+			Report.Unit(out, result)
+			return &UnitFailure{Kind: FailureSync, Space: unit.SpaceName, Unit: unit.UnitName,
+				Err: fmt.Errorf("failed to sync %s/%s: %w", unit.SpaceName, unit.UnitName, err)}
+		}
+		Report.Unit(out, result)
+		return nil
+	})
+	if err != nil {
+		unitErrs, ok := unitFailures(err)
+		if !KeepGoing || !ok {
 			return err
 		}
+		failures = append(failures, unitErrs...)
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
 
-		fmt.Printf("  ✓ %s/%s synced\n", unit.SpaceName, unit.UnitName)
+// syncUnit creates or updates a single unit, recording the action taken in result
+func (s *Syncer) syncUnit(ctx context.Context, spaceID goclientnew.UUID, unit pkgconfig.ResolvedUnit, result *UnitResult) error {
+	// Check if unit exists
+	existingUnit, err := s.getUnitBySlug(ctx, spaceID, unit.UnitName)
+	if err != nil {
+		return fmt.Errorf("failed to check unit %s: %w", unit.UnitName, err)
 	}
 
+	var synced *goclientnew.Unit
+	if existingUnit != nil {
+		result.UnitID = existingUnit.UnitID.String()
+		result.Revision = existingUnit.HeadRevisionNum
+
+		// Skip units whose content, labels and toolchain already match
+		if !unitChanged(existingUnit, unit) {
+			result.Action = ActionUnchanged
+			return nil
+		}
+
+		result.Action = ActionLabels
+		if dataChanged(existingUnit, unit) {
+			result.Action = ActionUpdate
+		}
+
+		// Update existing unit (merges labels with existing)
+		synced, err = s.updateUnit(ctx, spaceID, existingUnit.UnitID, existingUnit, unit)
+	} else {
+		// Create new unit
+		result.Action = ActionCreate
+		synced, err = s.createUnit(ctx, spaceID, unit)
+	}
+	if err != nil {
+		return err
+	}
+
+	if synced != nil {
+		result.UnitID = synced.UnitID.String()
+		result.Revision = synced.HeadRevisionNum
+	}
 	return nil
 }
 
@@ -288,12 +387,15 @@ func (s *Syncer) SyncDown(ctx context.Context, units []pkgconfig.ResolvedUnit) e
 	spaceCache := make(map[string]goclientnew.UUID)
 	missingSpaces := make(map[string]bool)
 
+	out := Report.Writer()
 	for _, unit := range units {
-		fmt.Printf("Deleting %s/%s...\n", unit.SpaceName, unit.UnitName)
+		fmt.Fprintf(out, "Deleting %s/%s...\n", unit.SpaceName, unit.UnitName)
+		result := UnitResult{Space: unit.SpaceName, Unit: unit.UnitName, Action: ActionSkip}
 
 		// Check if we already know this space is missing
 		if missingSpaces[unit.SpaceName] {
-			fmt.Printf("  ! Space %s not found, skipping\n", unit.SpaceName)
+			result.Message = fmt.Sprintf("Space %s not found", unit.SpaceName)
+			Report.Unit(out, result)
 			continue
 		}
 
@@ -304,7 +406,8 @@ func (s *Syncer) SyncDown(ctx context.Context, units []pkgconfig.ResolvedUnit) e
 			spaceID, err = s.getSpaceID(ctx, unit.SpaceName)
 			if err != nil {
 				missingSpaces[unit.SpaceName] = true
-				fmt.Printf("  ! Space %s not found, skipping\n", unit.SpaceName)
+				result.Message = fmt.Sprintf("Space %s not found", unit.SpaceName)
+				Report.Unit(out, result)
 				continue
 			}
 			spaceCache[unit.SpaceName] = spaceID
@@ -313,111 +416,165 @@ func (s *Syncer) SyncDown(ctx context.Context, units []pkgconfig.ResolvedUnit) e
 		// Check if unit exists
 		existingUnit, err := s.getUnitBySlug(ctx, spaceID, unit.UnitName)
 		if err != nil {
-			return fmt.Errorf("failed to check unit %s: %w", unit.UnitName, err)
+			err = fmt.Errorf("failed to check unit %s: %w", unit.UnitName, err)
+			result.Error = err.Error()
+			Report.Unit(out, result)
+			return err
 		}
 
 		if existingUnit == nil {
-			fmt.Printf("  ! Unit %s not found, skipping\n", unit.UnitName)
+			result.Message = fmt.Sprintf("Unit %s not found", unit.UnitName)
+			Report.Unit(out, result)
 			continue
 		}
 
 		// Delete the unit
-		resp, err := s.client.DeleteUnitWithResponse(ctx, spaceID, existingUnit.UnitID)
-		if err != nil {
-			return fmt.Errorf("failed to delete unit %s: %w", unit.UnitName, err)
+		result.Action = ActionDelete
+		result.UnitID = existingUnit.UnitID.String()
+		result.Revision = existingUnit.HeadRevisionNum
+		if err := s.deleteUnit(ctx, spaceID, existingUnit.UnitID, unit.UnitName); err != nil {
+			result.Error = err.Error()
+			Report.Unit(out, result)
+			return err
 		}
 
-		if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusNoContent {
-			return fmt.Errorf("failed to delete unit %s: %s", unit.UnitName, resp.Status())
-		}
+		Report.Unit(out, result)
+	}
+
+	return nil
+}
+
+// DeleteEmptySpaces deletes spaces that were created by cub-compose and no longer contain units
+func (s *Syncer) DeleteEmptySpaces(ctx context.Context, spaces []pkgconfig.ResolvedSpace) error {
+	for _, space := range spaces {
+		Report.Printf("Deleting space %s...\n", space.Name)
 
-		fmt.Printf("  ✓ %s/%s deleted\n", unit.SpaceName, unit.UnitName)
+		result, err := s.deleteEmptySpace(ctx, space.Name)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		Report.Space(result)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// deleteEmptySpace deletes a space if cub-compose created it and it is empty
+func (s *Syncer) deleteEmptySpace(ctx context.Context, spaceName string) (SpaceResult, error) {
+	result := SpaceResult{Space: spaceName, Action: ActionSkip}
+
+	existing, err := s.findSpace(ctx, spaceName)
+	if err != nil {
+		return result, fmt.Errorf("failed to look up space %s: %w", spaceName, err)
+	}
+
+	if existing == nil {
+		result.Message = fmt.Sprintf("Space %s not found", spaceName)
+		return result, nil
+	}
+
+	result.Action = ActionKeep
+	result.SpaceID = existing.SpaceID.String()
+	if existing.Labels[createdByLabel] != createdByValue {
+		result.Message = fmt.Sprintf("Space %s was not created by cub-compose (no %s=%s label)", spaceName, createdByLabel, createdByValue)
+		return result, nil
+	}
+
+	units, err := s.listUnits(ctx, existing.SpaceID, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to list units in space %s: %w", spaceName, err)
+	}
+	if len(units) > 0 {
+		result.Message = fmt.Sprintf("Space %s still contains %d units", spaceName, len(units))
+		return result, nil
+	}
+
+	result.Action = ActionDelete
+	return result, s.deleteSpace(ctx, existing.SpaceID, spaceName)
+}
+
 // getSpaceID looks up a space by slug (lookup only, returns error if not found)
 func (s *Syncer) getSpaceID(ctx context.Context, spaceSlug string) (goclientnew.UUID, error) {
-	where := fmt.Sprintf("Slug = '%s'", spaceSlug)
+	space, err := s.findSpace(ctx, spaceSlug)
+	if err != nil {
+		return goclientnew.UUID{}, err
+	}
+	if space == nil {
+		return goclientnew.UUID{}, fmt.Errorf("space %q not found", spaceSlug)
+	}
+	return space.SpaceID, nil
+}
+
+// findSpace looks up a space by slug, returning nil if it doesn't exist
+func (s *Syncer) findSpace(ctx context.Context, spaceSlug string) (*goclientnew.Space, error) {
+	where := whereEq("Slug", spaceSlug).String()
 	params := &goclientnew.ListSpacesParams{
 		Where: &where,
 	}
 
 	resp, err := s.client.ListSpacesWithResponse(ctx, params)
 	if err != nil {
-		return goclientnew.UUID{}, err
+		return nil, err
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return goclientnew.UUID{}, fmt.Errorf("failed to list spaces: %s", resp.Status())
+		return nil, apiError("failed to list spaces", resp)
 	}
 
 	if resp.JSON200 == nil || len(*resp.JSON200) == 0 {
-		return goclientnew.UUID{}, fmt.Errorf("space %q not found", spaceSlug)
+		return nil, nil // Not found
 	}
 
 	extSpace := (*resp.JSON200)[0]
 	if extSpace.Space == nil {
-		return goclientnew.UUID{}, fmt.Errorf("space %q has no Space data", spaceSlug)
+		return nil, fmt.Errorf("space %q has no Space data", spaceSlug)
 	}
-	return extSpace.Space.SpaceID, nil
+	return extSpace.Space, nil
 }
 
 // ensureSpace looks up a space by slug; creates it if it doesn't exist
 func (s *Syncer) ensureSpace(ctx context.Context, spaceSlug string, labels map[string]string) (goclientnew.UUID, error) {
 	// Try to find existing space
-	where := fmt.Sprintf("Slug = '%s'", spaceSlug)
-	params := &goclientnew.ListSpacesParams{
-		Where: &where,
-	}
-
-	resp, err := s.client.ListSpacesWithResponse(ctx, params)
+	space, err := s.findSpace(ctx, spaceSlug)
 	if err != nil {
 		return goclientnew.UUID{}, err
 	}
 
-	if resp.StatusCode() != http.StatusOK {
-		return goclientnew.UUID{}, fmt.Errorf("failed to list spaces: %s", resp.Status())
-	}
-
 	// Space exists, merge labels and update if needed
-	if resp.JSON200 != nil && len(*resp.JSON200) > 0 {
-		extSpace := (*resp.JSON200)[0]
-		if extSpace.Space == nil {
-			return goclientnew.UUID{}, fmt.Errorf("space %q has no Space data", spaceSlug)
+	if space != nil {
+		// Merge labels: existing ConfigHub labels + YAML labels (YAML wins)
+		mergedLabels := mergeLabels(space.Labels, labels)
+		if maps.Equal(space.Labels, mergedLabels) {
+			Report.Space(SpaceResult{Space: spaceSlug, Action: ActionUnchanged, SpaceID: space.SpaceID.String()})
+			return space.SpaceID, nil
 		}
 
-		// Merge labels: existing ConfigHub labels + YAML labels (YAML wins)
-		mergedLabels := mergeLabels(extSpace.Space.Labels, labels)
-		if len(mergedLabels) > 0 {
-			updateBody := goclientnew.Space{
-				Slug:        spaceSlug,
-				DisplayName: extSpace.Space.DisplayName,
-				Labels:      mergedLabels,
-			}
-			updateResp, err := s.client.UpdateSpaceWithResponse(ctx, extSpace.Space.SpaceID, nil, updateBody)
-			if err != nil {
-				return goclientnew.UUID{}, fmt.Errorf("failed to update space labels: %w", err)
-			}
-			if updateResp.StatusCode() != http.StatusOK {
-				return goclientnew.UUID{}, fmt.Errorf("failed to update space labels: %s", updateResp.Status())
-			}
+		updateBody := goclientnew.Space{
+			Slug:        spaceSlug,
+			DisplayName: space.DisplayName,
+			Labels:      mergedLabels,
+		}
+		updateResp, err := s.client.UpdateSpaceWithResponse(ctx, space.SpaceID, nil, updateBody)
+		if err != nil {
+			return goclientnew.UUID{}, fmt.Errorf("failed to update space labels: %w", err)
+		}
+		if updateResp.StatusCode() != http.StatusOK {
+			return goclientnew.UUID{}, apiError("failed to update space labels", updateResp)
 		}
 
-		return extSpace.Space.SpaceID, nil
+		Report.Space(SpaceResult{Space: spaceSlug, Action: ActionUpdate, SpaceID: space.SpaceID.String()})
+		return space.SpaceID, nil
 	}
 
 	// Space doesn't exist, create it
-	fmt.Printf("  Creating space %s...\n", spaceSlug)
+	Report.Printf("  Creating space %s...\n", spaceSlug)
 	createBody := goclientnew.Space{
 		Slug:        spaceSlug,
 		DisplayName: spaceSlug,
-	}
-
-	// Add labels if present
-	if len(labels) > 0 {
-		createBody.Labels = labels
+		Labels:      mergeLabels(labels, map[string]string{createdByLabel: createdByValue}),
 	}
 
 	createResp, err := s.client.CreateSpaceWithResponse(ctx, nil, createBody)
@@ -426,19 +583,20 @@ func (s *Syncer) ensureSpace(ctx context.Context, spaceSlug string, labels map[s
 	}
 
 	if createResp.StatusCode() != http.StatusOK && createResp.StatusCode() != http.StatusCreated {
-		return goclientnew.UUID{}, fmt.Errorf("failed to create space: %s", createResp.Status())
+		return goclientnew.UUID{}, apiError("failed to create space", createResp)
 	}
 
 	if createResp.JSON200 == nil {
 		return goclientnew.UUID{}, fmt.Errorf("no space returned after creation")
 	}
 
+	Report.Space(SpaceResult{Space: spaceSlug, Action: ActionCreate, SpaceID: createResp.JSON200.SpaceID.String()})
 	return createResp.JSON200.SpaceID, nil
 }
 
 // getUnitBySlug looks up a unit by slug within a space
 func (s *Syncer) getUnitBySlug(ctx context.Context, spaceID goclientnew.UUID, unitSlug string) (*goclientnew.Unit, error) {
-	where := fmt.Sprintf("Slug = '%s'", unitSlug)
+	where := whereEq("Slug", unitSlug).String()
 	params := &goclientnew.ListUnitsParams{
 		Where: &where,
 	}
@@ -449,7 +607,7 @@ func (s *Syncer) getUnitBySlug(ctx context.Context, spaceID goclientnew.UUID, un
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to list units: %s", resp.Status())
+		return nil, apiError("failed to list units", resp)
 	}
 
 	if resp.JSON200 == nil || len(*resp.JSON200) == 0 {
@@ -460,9 +618,9 @@ func (s *Syncer) getUnitBySlug(ctx context.Context, spaceID goclientnew.UUID, un
 	return extUnit.Unit, nil
 }
 
-// createUnit creates a new unit
-func (s *Syncer) createUnit(ctx context.Context, spaceID goclientnew.UUID, unit pkgconfig.ResolvedUnit) error {
-	toolchainType := string(workerapi.ToolchainKubernetesYAML)
+// createUnit creates a new unit and returns it as created (nil if the response has no body)
+func (s *Syncer) createUnit(ctx context.Context, spaceID goclientnew.UUID, unit pkgconfig.ResolvedUnit) (*goclientnew.Unit, error) {
+	toolchainType := unitToolchain(unit)
 	body := goclientnew.Unit{
 		Slug:          unit.UnitName,
 		DisplayName:   unit.UnitName,
@@ -475,21 +633,27 @@ func (s *Syncer) createUnit(ctx context.Context, spaceID goclientnew.UUID, unit
 		body.Labels = unit.Labels
 	}
 
+	// Record where the content came from
+	if annotations := sourceAnnotations(unit); len(annotations) > 0 {
+		body.Annotations = annotations
+	}
+
 	resp, err := s.client.CreateUnitWithResponse(ctx, spaceID, nil, body)
 	if err != nil {
-		return fmt.Errorf("failed to create unit: %w", err)
+		return nil, fmt.Errorf("failed to create unit: %w", err)
 	}
 
 	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusCreated {
-		return fmt.Errorf("failed to create unit: %s", resp.Status())
+		return nil, apiError("failed to create unit", resp)
 	}
 
-	return nil
+	return resp.JSON200, nil
 }
 
-// updateUnit updates an existing unit's data, merging labels with existing ones
-func (s *Syncer) updateUnit(ctx context.Context, spaceID, unitID goclientnew.UUID, existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) error {
-	toolchainType := string(workerapi.ToolchainKubernetesYAML)
+// updateUnit updates an existing unit's data, merging labels with existing ones, and returns
+// it as updated (nil if the response has no body)
+func (s *Syncer) updateUnit(ctx context.Context, spaceID, unitID goclientnew.UUID, existingUnit *goclientnew.Unit, unit pkgconfig.ResolvedUnit) (*goclientnew.Unit, error) {
+	toolchainType := unitToolchain(unit)
 	body := goclientnew.Unit{
 		Slug:          unit.UnitName,
 		DisplayName:   unit.UnitName,
@@ -503,14 +667,103 @@ func (s *Syncer) updateUnit(ctx context.Context, spaceID, unitID goclientnew.UUI
 		body.Labels = mergedLabels
 	}
 
+	// Merge annotations: existing ConfigHub annotations + source annotations
+	mergedAnnotations := mergeLabels(existingUnit.Annotations, sourceAnnotations(unit))
+	if len(mergedAnnotations) > 0 {
+		body.Annotations = mergedAnnotations
+	}
+
 	resp, err := s.client.UpdateUnitWithResponse(ctx, spaceID, unitID, nil, body)
 	if err != nil {
-		return fmt.Errorf("failed to update unit: %w", err)
+		return nil, fmt.Errorf("failed to update unit: %w", err)
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("failed to update unit: %s", resp.Status())
+		return nil, apiError("failed to update unit", resp)
+	}
+
+	return resp.JSON200, nil
+}
+
+// deleteUnit deletes a unit by ID
+func (s *Syncer) deleteUnit(ctx context.Context, spaceID, unitID goclientnew.UUID, unitSlug string) error {
+	resp, err := s.client.DeleteUnitWithResponse(ctx, spaceID, unitID)
+	if err != nil {
+		return fmt.Errorf("failed to delete unit %s: %w", unitSlug, err)
+	}
+
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusNoContent {
+		return apiError("failed to delete unit "+unitSlug, resp)
 	}
 
 	return nil
 }
+
+// deleteSpace deletes a space by ID
+func (s *Syncer) deleteSpace(ctx context.Context, spaceID goclientnew.UUID, spaceSlug string) error {
+	resp, err := s.client.DeleteSpaceWithResponse(ctx, spaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete space %s: %w", spaceSlug, err)
+	}
+
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusNoContent {
+		return apiError("failed to delete space "+spaceSlug, resp)
+	}
+
+	return nil
+}
+
+// listSpaces lists all spaces matching a where filter
+func (s *Syncer) listSpaces(ctx context.Context, where whereFilter) ([]*goclientnew.Space, error) {
+	filter := where.String()
+	params := &goclientnew.ListSpacesParams{
+		Where: &filter,
+	}
+
+	resp, err := s.client.ListSpacesWithResponse(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, apiError("failed to list spaces", resp)
+	}
+
+	var spaces []*goclientnew.Space
+	if resp.JSON200 != nil {
+		for _, extSpace := range *resp.JSON200 {
+			if extSpace.Space != nil {
+				spaces = append(spaces, extSpace.Space)
+			}
+		}
+	}
+	return spaces, nil
+}
+
+// listUnits lists all units in a space, optionally matching a where filter
+func (s *Syncer) listUnits(ctx context.Context, spaceID goclientnew.UUID, where whereFilter) ([]*goclientnew.Unit, error) {
+	params := &goclientnew.ListUnitsParams{}
+	if len(where) > 0 {
+		filter := where.String()
+		params.Where = &filter
+	}
+
+	resp, err := s.client.ListUnitsWithResponse(ctx, spaceID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, apiError("failed to list units", resp)
+	}
+
+	var units []*goclientnew.Unit
+	if resp.JSON200 != nil {
+		for _, extUnit := range *resp.JSON200 {
+			if extUnit.Unit != nil {
+				units = append(units, extUnit.Unit)
+			}
+		}
+	}
+	return units, nil
+}
@@ -0,0 +1,200 @@
+package compose
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// PathInfo describes a path matched by a unit-set, for use in its name template
+type PathInfo struct {
+	Path   string // path relative to the repo root (e.g., "components/backend/production")
+	Base   string // last element (e.g., "production")
+	Name   string // last element without its extension (e.g., "backend" for "backend.yaml")
+	Parent string // last element of the parent directory (e.g., "backend")
+}
+
+// UnitSetMatch is the data passed to a unit-set name template
+type UnitSetMatch struct {
+	Dir  PathInfo // directory of the generated unit
+	File PathInfo // matched file; empty for match-dirs
+}
+
+// newPathInfo describes a slash-separated path
+func newPathInfo(p string) PathInfo {
+	base := path.Base(p)
+	return PathInfo{
+		Path:   p,
+		Base:   base,
+		Name:   strings.TrimSuffix(base, path.Ext(base)),
+		Parent: path.Base(path.Dir(p)),
+	}
+}
+
+// unitSetTemplate parses the name template of a unit-set, applying the default for its kind
+func unitSetTemplate(set *config.UnitSet) (*template.Template, error) {
+	name := set.Name
+	if name == "" {
+		name = "{{.Dir.Base}}"
+		if set.MatchFiles != "" {
+			name = "{{.File.Name}}"
+		}
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// validateUnitSet checks a unit-set declaration before it is expanded
+func validateUnitSet(set *config.UnitSet) error {
+	if (set.MatchDirs == "") == (set.MatchFiles == "") {
+		return fmt.Errorf("exactly one of match-dirs or match-files is required")
+	}
+	if set.Dir != "" {
+		return fmt.Errorf("dir is set from the match and must not be given")
+	}
+	if err := validateFilePatterns([]string{set.MatchDirs + set.MatchFiles}); err != nil {
+		return err
+	}
+	if set.MatchFiles != "" && (len(set.Cmd) > 0 || len(set.Files) > 0) {
+		return fmt.Errorf("match-files units read the matched file; cmd and files must not be given")
+	}
+	if set.MatchDirs != "" && len(set.Cmd) == 0 && len(set.Files) == 0 {
+		return fmt.Errorf("either 'cmd' or 'files' is required")
+	}
+	if len(set.Cmd) > 0 && len(set.Files) > 0 {
+		return fmt.Errorf("'cmd' and 'files' are mutually exclusive")
+	}
+	if _, err := unitSetTemplate(set); err != nil {
+		return err
+	}
+	return validateUnit(&set.Unit)
+}
+
+// declaredUnits returns where each unit of cfg was declared, by space (with the space-prefix
+// applied) and unit name
+func declaredUnits(cfg *config.ComposeConfig) map[string]string {
+	declared := make(map[string]string)
+	for _, repo := range cfg.Configs {
+		for spaceName, space := range repo.Spaces {
+			if space == nil {
+				continue
+			}
+			for unitName, unit := range space.Units {
+				if unit != nil {
+					declared[applySpacePrefix(cfg, spaceName)+"/"+unitName] = unit.Source
+				}
+			}
+		}
+	}
+	return declared
+}
+
+// expandUnitSets declares the units generated by the unit-sets of a repo, matching their
+// globs inside repoPath. Generated names must not be in declared, which holds the units of
+// every config entry as returned by declaredUnits and gets the new ones added. The unit-sets
+// are removed once expanded.
+func expandUnitSets(cfg *config.ComposeConfig, repoCfg *config.RepoConfig, repoPath string, declared map[string]string, out io.Writer) error {
+	root, err := os.OpenRoot(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repo root: %w", err)
+	}
+	defer root.Close()
+
+	var dirs, files []string
+	for _, spaceName := range sortedKeys(repoCfg.Spaces) {
+		space := repoCfg.Spaces[spaceName]
+		if space == nil {
+			continue
+		}
+
+		for _, set := range space.UnitSets {
+			// List the repo once for each kind of match
+			pattern, candidates := set.MatchDirs, &dirs
+			if set.MatchFiles != "" {
+				pattern, candidates = set.MatchFiles, &files
+			}
+			if *candidates == nil {
+				*candidates, err = listPaths(root, set.MatchDirs != "")
+				if err != nil {
+					return err
+				}
+			}
+
+			names, err := expandUnitSet(space, applySpacePrefix(cfg, spaceName), set, pattern, *candidates, declared)
+			if err != nil {
+				return fmt.Errorf("%s: space %s: unit-set %s: %w", set.Source, spaceName, pattern, err)
+			}
+			fmt.Fprintf(out, "  Expanded unit-set %s in space %s: %s\n", pattern, spaceName, strings.Join(names, ", "))
+		}
+		space.UnitSets = nil
+	}
+
+	return nil
+}
+
+// expandUnitSet adds a unit to space for each candidate path matching pattern and returns their
+// names. fullName is the space name with the space-prefix, used to look up names in declared.
+func expandUnitSet(space *config.Space, fullName string, set *config.UnitSet, pattern string, candidates []string, declared map[string]string) ([]string, error) {
+	tmpl, err := unitSetTemplate(set)
+	if err != nil {
+		return nil, err
+	}
+	if space.Units == nil {
+		space.Units = make(map[string]*config.Unit)
+	}
+
+	var names []string
+	for _, p := range candidates {
+		if !matchGlob(pattern, p) {
+			continue
+		}
+
+		unit := set.Unit
+		match := UnitSetMatch{Dir: newPathInfo(p)}
+		if set.MatchFiles != "" {
+			match = UnitSetMatch{Dir: newPathInfo(path.Dir(p)), File: newPathInfo(p)}
+			unit.Files = []string{match.File.Base}
+		}
+		unit.Dir = match.Dir.Path
+
+		var name strings.Builder
+		if err := tmpl.Execute(&name, match); err != nil {
+			return nil, fmt.Errorf("failed to render name for %s: %w", p, err)
+		}
+		unitName := strings.TrimSpace(name.String())
+		if err := validateSlug(unitName); err != nil {
+			return nil, fmt.Errorf("name for %s: %w", p, err)
+		}
+		key := fullName + "/" + unitName
+		if first, exists := declared[key]; exists {
+			return nil, fmt.Errorf("unit %s for %s is already declared at %s", unitName, p, first)
+		}
+
+		declared[key] = set.Source
+		space.Units[unitName] = &unit
+		names = append(names, unitName)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no paths match")
+	}
+	return names, nil
+}
+
+// hasUnitSets reports whether any space of a repo declares unit-sets
+func hasUnitSets(repoCfg *config.RepoConfig) bool {
+	for _, space := range repoCfg.Spaces {
+		if space != nil && len(space.UnitSets) > 0 {
+			return true
+		}
+	}
+	return false
+}
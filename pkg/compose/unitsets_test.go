@@ -0,0 +1,112 @@
+package compose
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandUnitSetsDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string // "" if the names are unique; configs.yaml stands for its path
+	}{
+		{
+			name: "unique names",
+			config: `configs:
+- path: ./a
+  spaces:
+    dev:
+      units:
+        db: {dir: ., cmd: echo}
+- path: ./b
+  spaces:
+    dev:
+      unit-sets:
+      - {match-dirs: components/*, cmd: echo}
+`,
+		},
+		{
+			name: "unit declared by another entry",
+			config: `configs:
+- path: ./a
+  spaces:
+    dev:
+      units:
+        api: {dir: ., cmd: echo}
+- path: ./b
+  spaces:
+    dev:
+      unit-sets:
+      - {match-dirs: components/*, cmd: echo}
+`,
+			err: "configs.yaml:11: space dev: unit-set components/*: unit api for components/api is already declared at configs.yaml:6",
+		},
+		{
+			name: "unit generated by another entry",
+			config: `configs:
+- path: ./a
+  spaces:
+    dev:
+      unit-sets:
+      - {match-dirs: components/*, cmd: echo}
+- path: ./b
+  spaces:
+    dev:
+      unit-sets:
+      - {match-dirs: components/*, cmd: echo}
+`,
+			err: "configs.yaml:11: space dev: unit-set components/*: unit api for components/api is already declared at configs.yaml:6",
+		},
+		{
+			name: "other spaces don't clash",
+			config: `configs:
+- path: ./a
+  spaces:
+    prod:
+      units:
+        api: {dir: ., cmd: echo}
+- path: ./b
+  spaces:
+    dev:
+      unit-sets:
+      - {match-dirs: components/*, cmd: echo}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, repo := range []string{"a", "b"} {
+				for _, component := range []string{"api", "web"} {
+					if err := os.MkdirAll(filepath.Join(dir, repo, "components", component), 0755); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			path := filepath.Join(dir, "configs.yaml")
+			writeFile(t, path, tt.config)
+			cfg, err := LoadConfig([]string{path}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			declared := declaredUnits(cfg)
+			for i := range cfg.Configs {
+				repo := &cfg.Configs[i]
+				if err = expandUnitSets(cfg, repo, repo.Path, declared, io.Discard); err != nil {
+					break
+				}
+			}
+			if tt.err == "" && err != nil {
+				t.Errorf("expandUnitSets = %v, want no error", err)
+			}
+			if want := strings.ReplaceAll(tt.err, "configs.yaml", path); tt.err != "" && (err == nil || err.Error() != want) {
+				t.Errorf("expandUnitSets = %v, want %s", err, want)
+			}
+		})
+	}
+}
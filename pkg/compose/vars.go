@@ -0,0 +1,198 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// varResolver interpolates ${NAME} references, recording undefined and malformed ones
+type varResolver struct {
+	set       map[string]string // --set values, which take precedence
+	vars      map[string]string // vars section of the config file
+	undefined map[string]string // undefined name -> first place it is used
+	errs      []string
+}
+
+// lookup returns the value of a variable from --set, the config file or the environment, in
+// that order. The config file comes before the environment so that common names such as ENV
+// or TAG set by a CI shell can't silently change space names and refs.
+func (r *varResolver) lookup(name string) (string, bool) {
+	if v, ok := r.set[name]; ok {
+		return v, true
+	}
+	if v, ok := r.vars[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+// isVarName reports whether s is a valid variable name: a letter or underscore followed by
+// letters, digits or underscores
+func isVarName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && (i == 0 || !('0' <= c && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// interpolate replaces each ${NAME} in s with its value; $${ is a literal ${.
+// A $ not followed by { is left alone, so $HOME in shell commands keeps working.
+func (r *varResolver) interpolate(s, where string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	var out strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			// s[:i] ends with the escaping $, which together with { gives a literal ${
+			out.WriteString(s[:i])
+			out.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		out.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			r.errs = append(r.errs, fmt.Sprintf("%s: unterminated ${ in %q", where, s))
+			return out.String()
+		}
+		name := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		if !isVarName(name) {
+			r.errs = append(r.errs, fmt.Sprintf("%s: invalid variable name %q", where, name))
+			continue
+		}
+		value, ok := r.lookup(name)
+		if !ok {
+			if _, seen := r.undefined[name]; !seen {
+				r.undefined[name] = where
+			}
+			continue
+		}
+		out.WriteString(value)
+	}
+	out.WriteString(s)
+	return out.String()
+}
+
+// interpolateMap interpolates the values of a map in place
+func (r *varResolver) interpolateMap(m map[string]string, where string) {
+	for _, k := range sortedKeys(m) {
+		m[k] = r.interpolate(m[k], where)
+	}
+}
+
+// interpolateUnit interpolates the dir, cmd, env and labels of a unit declared at pos. Shell
+// commands are left to the shell, which has its own ${...} syntax; they can read variables
+// passed through env.
+func (r *varResolver) interpolateUnit(unit *config.Unit, pos position) {
+	unit.Dir = r.interpolate(unit.Dir, pos.at("dir"))
+	if !unit.Shell {
+		for i, step := range unit.Cmd {
+			unit.Cmd[i] = r.interpolate(step, pos.at("cmd"))
+		}
+	}
+	r.interpolateMap(unit.Env, pos.at("env"))
+	r.interpolateMap(unit.Labels, pos.at("labels"))
+}
+
+// err reports undefined variables and malformed references, or nil if there are none
+func (r *varResolver) err() error {
+	msgs := r.errs
+	if len(r.undefined) > 0 {
+		names := sortedKeys(r.undefined)
+		details := make([]string, len(names))
+		for i, name := range names {
+			details[i] = fmt.Sprintf("%s (used in %s)", name, r.undefined[name])
+		}
+		msgs = append(msgs, "undefined variables: "+strings.Join(details, ", ")+
+			"; define them in vars, with --set NAME=VALUE or in the environment")
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+}
+
+// interpolateConfig replaces ${NAME} references in space names, the space prefix, refs,
+// labels and unit dir, cmd (unless run by a shell) and env with values from set, cfg.Vars
+// or the environment.
+// Errors name the file and line from src.
+func interpolateConfig(cfg *config.ComposeConfig, set map[string]string, src *configSource) error {
+	r := &varResolver{set: set, vars: cfg.Vars, undefined: make(map[string]string)}
+	for _, name := range sortedKeys(cfg.Vars) {
+		if !isVarName(name) {
+			r.errs = append(r.errs, fmt.Sprintf("%s: invalid variable name %q", src.top.at("vars"), name))
+		}
+	}
+	for _, name := range sortedKeys(set) {
+		if !isVarName(name) {
+			r.errs = append(r.errs, fmt.Sprintf("--set: invalid variable name %q", name))
+		}
+	}
+
+	cfg.SpacePrefix = r.interpolate(cfg.SpacePrefix, src.top.at("space-prefix"))
+	r.interpolateMap(cfg.CommonLabels, src.top.at("common-labels"))
+
+	for i := range cfg.Configs {
+		repo := &cfg.Configs[i]
+		pos := src.repo(i)
+
+		repo.Ref = r.interpolate(repo.Ref, pos.at("ref"))
+		r.interpolateMap(repo.UnitLabels, pos.at("unit-labels"))
+		r.interpolateMap(repo.Env, pos.at("env"))
+
+		// Space names can contain variables, so the map is rebuilt
+		spaces := make(map[string]*config.Space, len(repo.Spaces))
+		for _, rawName := range sortedKeys(repo.Spaces) {
+			space := repo.Spaces[rawName]
+			spacePos := src.space(i, space)
+			spaceName := r.interpolate(rawName, spacePos.loc)
+			if _, exists := spaces[spaceName]; exists {
+				r.errs = append(r.errs, fmt.Sprintf("%s: space %q is declared more than once after interpolation", spacePos.loc, spaceName))
+				continue
+			}
+			spaces[spaceName] = space
+			if space == nil {
+				continue
+			}
+
+			for _, unitName := range sortedKeys(space.Units) {
+				unit := space.Units[unitName]
+				if unit == nil {
+					continue
+				}
+				r.interpolateUnit(unit, src.unit(i, unit))
+			}
+			for _, set := range space.UnitSets {
+				if set == nil {
+					continue
+				}
+				setPos := src.unitSet(i, set)
+				set.MatchDirs = r.interpolate(set.MatchDirs, setPos.at("match-dirs"))
+				set.MatchFiles = r.interpolate(set.MatchFiles, setPos.at("match-files"))
+				r.interpolateUnit(&set.Unit, setPos)
+			}
+		}
+		if repo.Spaces != nil {
+			repo.Spaces = spaces
+		}
+	}
+
+	return r.err()
+}
@@ -0,0 +1,177 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// newTestResolver returns a resolver with the given --set values and vars
+func newTestResolver(set, vars map[string]string) *varResolver {
+	return &varResolver{set: set, vars: vars, undefined: make(map[string]string)}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("CUB_COMPOSE_TEST_ENV", "from-env")
+	r := newTestResolver(
+		map[string]string{"SET": "from-set", "EMPTY": ""},
+		map[string]string{"ENV": "production", "SET": "from-vars", "CUB_COMPOSE_TEST_ENV": "from-vars", "DOLLAR": "$x"},
+	)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no references", "kubectl kustomize .", "kubectl kustomize ."},
+		{"var", "components/${ENV}", "components/production"},
+		{"several", "${ENV}-${ENV}/${SET}", "production-production/from-set"},
+		{"--set wins over vars", "${SET}", "from-set"},
+		{"vars win over the environment", "${CUB_COMPOSE_TEST_ENV}", "from-vars"},
+		{"empty value", "a${EMPTY}b", "ab"},
+		{"values aren't interpolated again", "${DOLLAR}{ENV}", "$x{ENV}"},
+		{"$ without brace is literal", "echo $HOME $ENV $", "echo $HOME $ENV $"},
+		{"$${ is a literal ${", "echo '$${ENV}'", "echo '${ENV}'"},
+		{"$${ next to a reference", "$${ENV}${ENV}", "${ENV}production"},
+		{"$$${ is $ and a reference", "$$${ENV}", "$${ENV}"},
+		{"lone braces", "{ENV} }", "{ENV} }"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.interpolate(tt.in, "configs.yaml:1")
+			if got != tt.want {
+				t.Errorf("interpolate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if err := r.err(); err != nil {
+				t.Errorf("interpolate(%q) recorded errors: %v", tt.in, err)
+			}
+		})
+	}
+}
+
+func TestInterpolateFromEnvironment(t *testing.T) {
+	t.Setenv("CUB_COMPOSE_TEST_TAG", "v1.2.3")
+	r := newTestResolver(nil, nil)
+	if got := r.interpolate("${CUB_COMPOSE_TEST_TAG}", "configs.yaml:1"); got != "v1.2.3" {
+		t.Errorf("interpolate = %q, want the environment value", got)
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"undefined", "dir/${CUB_COMPOSE_TEST_UNDEFINED}", []string{
+			"undefined variables: CUB_COMPOSE_TEST_UNDEFINED (used in configs.yaml:7)", "--set NAME=VALUE",
+		}},
+		{"unterminated", "dir/${ENV", []string{`configs.yaml:7: unterminated ${ in "dir/${ENV"`}},
+		{"empty name", "${}", []string{`configs.yaml:7: invalid variable name ""`}},
+		{"leading digit", "${1X}", []string{`configs.yaml:7: invalid variable name "1X"`}},
+		{"shell default", "${ENV:-dev}", []string{`configs.yaml:7: invalid variable name "ENV:-dev"`}},
+		{"shell length", "${#ENV}", []string{`configs.yaml:7: invalid variable name "#ENV"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestResolver(nil, map[string]string{"ENV": "production"})
+			r.interpolate(tt.in, "configs.yaml:7")
+			err := r.err()
+			if err == nil {
+				t.Fatalf("interpolate(%q) recorded no error", tt.in)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("interpolate(%q) error = %q, want it to contain %q", tt.in, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInterpolateUndefinedReportedOnce(t *testing.T) {
+	r := newTestResolver(nil, nil)
+	r.interpolate("${CUB_COMPOSE_TEST_MISSING}", "a.yaml:1")
+	r.interpolate("${CUB_COMPOSE_TEST_MISSING}", "a.yaml:2")
+	err := r.err()
+	if err == nil || !strings.Contains(err.Error(), "used in a.yaml:1)") || strings.Contains(err.Error(), "a.yaml:2") {
+		t.Errorf("err = %v, want only the first use reported", err)
+	}
+}
+
+func TestInterpolateUnitShell(t *testing.T) {
+	r := newTestResolver(nil, map[string]string{"ENV": "production"})
+
+	unit := &config.Unit{
+		Dir:    "components/${ENV}",
+		Cmd:    config.Command{`echo "${TAG:-latest}" ${#ENV}`},
+		Shell:  true,
+		Env:    map[string]string{"TAG": "${ENV}"},
+		Labels: map[string]string{"Env": "${ENV}"},
+	}
+	r.interpolateUnit(unit, position{loc: "configs.yaml:3"})
+	if err := r.err(); err != nil {
+		t.Fatalf("shell command reported errors: %v", err)
+	}
+	want := &config.Unit{
+		Dir:    "components/production",
+		Cmd:    config.Command{`echo "${TAG:-latest}" ${#ENV}`},
+		Shell:  true,
+		Env:    map[string]string{"TAG": "production"},
+		Labels: map[string]string{"Env": "production"},
+	}
+	if !reflect.DeepEqual(unit, want) {
+		t.Errorf("interpolateUnit = %+v, want %+v", unit, want)
+	}
+
+	unit = &config.Unit{Cmd: config.Command{"helm template ${ENV}", "yq '.x = \"$${Y}\"'"}}
+	r.interpolateUnit(unit, position{loc: "configs.yaml:3"})
+	if want := (config.Command{"helm template production", "yq '.x = \"${Y}\"'"}); !reflect.DeepEqual(unit.Cmd, want) {
+		t.Errorf("cmd = %q, want %q", unit.Cmd, want)
+	}
+}
+
+func TestLoadConfigVars(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "repo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "configs.yaml")
+	writeFile(t, path, `vars:
+  ENV: production
+configs:
+- repo: ./repo
+  spaces:
+    ${ENV}:
+      units:
+        backend:
+          dir: ${ENV}
+          cmd: echo ${UNDEFINED_IN_TEST}
+`)
+
+	_, err := LoadConfig([]string{path}, nil)
+	if err == nil || !strings.Contains(err.Error(), "UNDEFINED_IN_TEST (used in "+path+":10)") {
+		t.Fatalf("LoadConfig error = %v, want the undefined variable with its line", err)
+	}
+
+	cfg, err := LoadConfig([]string{path}, map[string]string{"ENV": "staging", "UNDEFINED_IN_TEST": "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := cfg.Configs[0].Spaces["staging"].Units["backend"]
+	if unit.Dir != "staging" || unit.Cmd[0] != "echo ok" {
+		t.Errorf("unit = %+v, want --set values applied", unit)
+	}
+}
+
+// writeFile writes a test file, failing the test on errors
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
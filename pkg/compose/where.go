@@ -0,0 +1,33 @@
+package compose
+
+import "strings"
+
+// whereFilter builds a ConfigHub where filter from conditions joined with AND. Values are
+// quoted and escaped, so names and label values can't change the meaning of the filter;
+// attributes are written as-is and must come from code, not from configs.
+type whereFilter []string
+
+// whereEq returns a filter matching resources whose attribute equals value
+func whereEq(attr, value string) whereFilter {
+	return whereFilter{}.Eq(attr, value)
+}
+
+// Eq adds a condition that attr equals value
+func (w whereFilter) Eq(attr, value string) whereFilter {
+	return append(w, attr+" = "+quoteValue(value))
+}
+
+// String returns the filter as passed in the where parameter
+func (w whereFilter) String() string {
+	return strings.Join(w, " AND ")
+}
+
+// quoteValue quotes a string value, doubling single quotes inside it
+func quoteValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// labelAttr returns the attribute of a label, for filters on label values
+func labelAttr(key string) string {
+	return "Labels." + key
+}
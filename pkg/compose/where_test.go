@@ -0,0 +1,28 @@
+package compose
+
+import "testing"
+
+func TestWhereFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter whereFilter
+		want   string
+	}{
+		{"simple", whereEq("Slug", "dev"), "Slug = 'dev'"},
+		{"empty value", whereEq("Slug", ""), "Slug = ''"},
+		{"single quote", whereEq("Slug", "it's"), "Slug = 'it''s'"},
+		{"only quotes", whereEq("Slug", "''"), "Slug = ''''''"},
+		{"injection", whereEq("Slug", "x' OR '1' = '1"), "Slug = 'x'' OR ''1'' = ''1'"},
+		{"backslashes are literal", whereEq("Slug", `a\'b\`), `Slug = 'a\''b\'`},
+		{"double quotes are literal", whereEq("Slug", `say "hi"`), `Slug = 'say "hi"'`},
+		{"and", whereEq("Slug", "api").Eq(labelAttr("Project"), "shop"), "Slug = 'api' AND Labels.Project = 'shop'"},
+		{"no conditions", whereFilter{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.String(); got != tt.want {
+				t.Errorf("filter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
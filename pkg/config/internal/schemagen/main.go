@@ -0,0 +1,215 @@
+// Command schemagen writes the JSON Schema of configs.yaml, generated from the config types
+// and the comments in types.go. It is run by go generate in pkg/config.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/confighub/cub-compose/pkg/config"
+)
+
+// durationPattern matches durations accepted by time.ParseDuration, such as "90s" or "1m30s"
+const durationPattern = `^[0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h)([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))*$|^0$`
+
+func main() {
+	types := flag.String("types", "types.go", "Go source of the config types, for descriptions")
+	output := flag.String("o", "schema.json", "File to write the schema to")
+	flag.Parse()
+
+	data, err := generate(*types)
+	if err == nil {
+		err = os.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schemagen:", err)
+		os.Exit(1)
+	}
+}
+
+// generate returns the schema of config.ComposeConfig as indented JSON
+func generate(typesPath string) ([]byte, error) {
+	src, err := os.ReadFile(typesPath)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := parseComments(typesPath, src)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &schemaGenerator{comments: comments, defs: make(map[string]*config.Schema)}
+	root := g.structSchema(reflect.TypeOf(config.ComposeConfig{}))
+	root.SchemaURI = config.SchemaURI
+	root.Title = "cub-compose configs.yaml"
+	root.Defs = g.defs
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// schemaProvider is implemented by types whose YAML form differs from their Go type
+type schemaProvider interface {
+	JSONSchema() *config.Schema
+}
+
+// typeComments holds the doc comment of a type and the comments of its fields
+type typeComments struct {
+	doc    string
+	fields map[string]string
+}
+
+// parseComments extracts type and field comments from Go source
+func parseComments(path string, src []byte) (map[string]typeComments, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make(map[string]typeComments)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			tc := typeComments{doc: commentText(gen.Doc), fields: make(map[string]string)}
+			if typeSpec.Doc != nil {
+				tc.doc = commentText(typeSpec.Doc)
+			}
+			if st, ok := typeSpec.Type.(*ast.StructType); ok {
+				for _, field := range st.Fields.List {
+					text := commentText(field.Comment)
+					if text == "" {
+						text = commentText(field.Doc)
+					}
+					for _, name := range field.Names {
+						tc.fields[name.Name] = text
+					}
+				}
+			}
+			comments[typeSpec.Name.Name] = tc
+		}
+	}
+	return comments, nil
+}
+
+// commentText returns a comment group as a single line
+func commentText(group *ast.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
+
+// schemaGenerator builds schemas for Go types, collecting struct definitions in defs
+type schemaGenerator struct {
+	comments map[string]typeComments
+	defs     map[string]*config.Schema
+}
+
+// typeSchema returns the schema of a Go type; structs are referenced from $defs
+func (g *schemaGenerator) typeSchema(t reflect.Type) *config.Schema {
+	if p, ok := reflect.New(t).Elem().Interface().(schemaProvider); ok {
+		return p.JSONSchema()
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return &config.Schema{Type: "string", Pattern: durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.String:
+		return &config.Schema{Type: "string"}
+	case reflect.Bool:
+		return &config.Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &config.Schema{Type: "integer"}
+	case reflect.Slice:
+		return &config.Schema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &config.Schema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // guard against recursive types
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return &config.Schema{Ref: "#/$defs/" + t.Name()}
+	default:
+		return &config.Schema{}
+	}
+}
+
+// structSchema returns the schema of a struct, with a property per YAML field.
+// Inline fields contribute their properties and unknown properties are not allowed.
+// Map fields with a keys tag restrict their keys with the named config.KeyRules, and
+// string fields with an enum tag allow only the values of the named config.Enums.
+func (g *schemaGenerator) structSchema(t reflect.Type) *config.Schema {
+	s := &config.Schema{
+		Type:                 "object",
+		Description:          g.comments[t.Name()].doc,
+		Properties:           make(map[string]*config.Schema),
+		AdditionalProperties: false,
+	}
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+
+		if strings.Contains(opts, "inline") {
+			for prop, propSchema := range g.structSchema(field.Type).Properties {
+				s.Properties[prop] = propSchema
+			}
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		prop := g.typeSchema(field.Type)
+		if keys := field.Tag.Get("keys"); keys != "" {
+			rule, ok := config.KeyRules[keys]
+			if !ok {
+				panic(fmt.Sprintf("%s.%s: unknown keys rule %q", t.Name(), field.Name, keys))
+			}
+			prop.PropertyNames = rule
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			values, ok := config.Enums[enum]
+			if !ok {
+				panic(fmt.Sprintf("%s.%s: unknown enum %q", t.Name(), field.Name, enum))
+			}
+			prop.Enum = values
+		}
+		if desc := g.comments[t.Name()].fields[field.Name]; desc != "" {
+			if prop.Ref != "" {
+				// Keep the referenced definition's description separate from the field's
+				prop = &config.Schema{Ref: prop.Ref, Description: desc}
+			} else {
+				prop.Description = desc
+			}
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestSchemaUpToDate fails when schema.json wasn't regenerated after changing the config types
+func TestSchemaUpToDate(t *testing.T) {
+	want, err := generate("../../types.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("pkg/config/schema.json is out of date; run go generate ./pkg/config")
+	}
+}
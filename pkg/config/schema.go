@@ -0,0 +1,122 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+//go:generate go run ./internal/schemagen -o schema.json
+
+// schemaJSON is the JSON Schema of configs.yaml, generated from the types in types.go
+//
+//go:embed schema.json
+var schemaJSON []byte
+
+// SchemaURI identifies the JSON Schema dialect of the generated schema
+const SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// Name rules shared by the schema and LoadConfig, so editors and validate accept the same names
+const (
+	// SlugPattern matches valid ConfigHub space and unit slugs
+	SlugPattern = `^[A-Za-z0-9][A-Za-z0-9_-]*$`
+	SlugRule    = "must start with a letter or digit and contain only letters, digits, '-' and '_'"
+
+	// SpaceNamePattern matches space names as written in configs.yaml: slugs that may contain
+	// ${NAME} references, which LoadConfig checks against SlugPattern once they are replaced
+	SpaceNamePattern = `^([A-Za-z0-9]|\$\{[A-Za-z_][A-Za-z0-9_]*\})([A-Za-z0-9_-]|\$\{[A-Za-z_][A-Za-z0-9_]*\})*$`
+
+	// LabelKeyPattern matches valid label keys
+	LabelKeyPattern = `^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`
+	LabelKeyRule    = "must start and end with a letter or digit and contain only letters, digits, '.', '_', '-' and '/'"
+)
+
+// KeyRules are the rules for map keys, by the name used in the keys tag of a map field
+var KeyRules = map[string]*Schema{
+	"slug":  {Pattern: SlugPattern, Description: SlugRule},
+	"space": {Pattern: SpaceNamePattern, Description: SlugRule},
+	"label": {Pattern: LabelKeyPattern, Description: LabelKeyRule},
+}
+
+// Enums are the allowed values of string fields, by the name used in the enum tag of a field
+var Enums = map[string][]string{
+	"toolchain": toolchainNames(),
+}
+
+// toolchainNames returns ToolchainTypes as strings
+func toolchainNames() []string {
+	names := make([]string, len(ToolchainTypes))
+	for i, t := range ToolchainTypes {
+		names[i] = string(t)
+	}
+	return names
+}
+
+// Schema is the subset of JSON Schema used to describe configs.yaml
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	PropertyNames        *Schema            `json:"propertyNames,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // false or *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// UnmarshalJSON decodes a schema, with additionalProperties as a bool or a *Schema
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		*plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+	}
+	raw.plain = (*plain)(s)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch string(raw.AdditionalProperties) {
+	case "":
+	case "true", "false":
+		s.AdditionalProperties = string(raw.AdditionalProperties) == "true"
+	default:
+		var additional Schema
+		if err := json.Unmarshal(raw.AdditionalProperties, &additional); err != nil {
+			return err
+		}
+		s.AdditionalProperties = &additional
+	}
+	return nil
+}
+
+// JSONSchema describes a command as a string or a list of strings
+func (Command) JSONSchema() *Schema {
+	return &Schema{OneOf: []*Schema{
+		{Type: "string"},
+		{Type: "array", Items: &Schema{Type: "string"}},
+	}}
+}
+
+var (
+	schemaOnce sync.Once
+	schema     *Schema
+)
+
+// JSONSchema returns the JSON Schema of configs.yaml. It is generated from ComposeConfig
+// and the types it uses by go generate; descriptions come from the comments in types.go.
+func JSONSchema() *Schema {
+	schemaOnce.Do(func() {
+		schema = &Schema{}
+		if err := json.Unmarshal(schemaJSON, schema); err != nil {
+			panic(fmt.Sprintf("invalid embedded schema.json: %v", err))
+		}
+	})
+	return schema
+}
@@ -0,0 +1,17 @@
+package config
+
+import "github.com/confighub/sdk/workerapi"
+
+// ToolchainTypes lists the toolchain types a unit may use. The SDK only declares them as
+// separate workerapi.Toolchain* constants, so this list is maintained by hand: a toolchain
+// added to the SDK must be added here before configs can use it. It is the only list of
+// toolchains in cub-compose: LoadConfig checks toolchain settings against it, and the
+// toolchain enum in schema.json is generated from it.
+var ToolchainTypes = []workerapi.ToolchainType{
+	workerapi.ToolchainKubernetesYAML,
+	workerapi.ToolchainOpenTofuHCL,
+	workerapi.ToolchainAppConfigProperties,
+	workerapi.ToolchainAppConfigTOML,
+	workerapi.ToolchainAppConfigINI,
+	workerapi.ToolchainAppConfigEnv,
+}
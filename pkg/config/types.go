@@ -1,32 +1,122 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 // ComposeConfig represents the root structure of configs.yaml
 type ComposeConfig struct {
-	Project      string            `yaml:"project,omitempty"`       // project name, adds Project label to all entities
-	SpacePrefix  string            `yaml:"space-prefix,omitempty"`  // prefix for all space names
-	CommonLabels map[string]string `yaml:"common-labels,omitempty"` // labels for all entities (spaces and units)
-	Configs      []RepoConfig      `yaml:"configs"`
+	Include      []string          `yaml:"include,omitempty"`                    // compose files merged before this one, relative to this file
+	Project      string            `yaml:"project,omitempty"`                    // project name, adds Project label to all entities
+	SpacePrefix  string            `yaml:"space-prefix,omitempty"`               // prefix for all space names
+	CommonLabels map[string]string `yaml:"common-labels,omitempty" keys:"label"` // labels for all entities (spaces and units)
+	Vars         map[string]string `yaml:"vars,omitempty"`                       // values for ${NAME} references; --set overrides them and the environment fills in the rest
+	Configs      []RepoConfig      `yaml:"configs"`                              // repositories and the spaces and units generated from them
 }
 
 // RepoConfig represents a Git repository with its spaces
 type RepoConfig struct {
-	Repo       string            `yaml:"repo"`
-	Ref        string            `yaml:"ref,omitempty"`         // branch or tag
-	UnitLabels map[string]string `yaml:"unit-labels,omitempty"` // labels for all units in this repo
-	Spaces     map[string]*Space `yaml:"spaces"`
+	Repo           string            `yaml:"repo,omitempty"`                       // git URL, or a local path (./dir, /dir, file://dir)
+	Path           string            `yaml:"path,omitempty"`                       // local directory used instead of cloning, relative to the config file
+	Ref            string            `yaml:"ref,omitempty"`                        // branch, tag or full commit SHA
+	UnitLabels     map[string]string `yaml:"unit-labels,omitempty" keys:"label"`   // labels for all units in this repo
+	Toolchain      string            `yaml:"toolchain,omitempty" enum:"toolchain"` // default toolchain type for units in this repo
+	Env            map[string]string `yaml:"env,omitempty"`                        // environment variables for all unit commands in this repo
+	EnvPassthrough []string          `yaml:"env-passthrough,omitempty"`            // parent environment variables passed to all unit commands
+	Timeout        time.Duration     `yaml:"timeout,omitempty"`                    // default maximum run time for unit commands (e.g., "2m")
+	Auth           *RepoAuth         `yaml:"auth,omitempty"`                       // credentials for cloning a private repository
+	Spaces         map[string]*Space `yaml:"spaces" keys:"space"`                  // spaces by name, with the units generated from this repo
+}
+
+// RepoAuth configures credentials used only for one repository's git operations
+type RepoAuth struct {
+	SSHKey           string `yaml:"ssh-key,omitempty"`           // path to an SSH private key
+	KnownHosts       string `yaml:"known-hosts,omitempty"`       // path to a known_hosts file used for SSH host verification
+	TokenEnv         string `yaml:"token-env,omitempty"`         // environment variable holding an HTTPS access token
+	Username         string `yaml:"username,omitempty"`          // username sent with the token (default "x-access-token")
+	CredentialHelper string `yaml:"credential-helper,omitempty"` // git credential helper command (e.g., "!gh auth git-credential")
+}
+
+// IsLocal reports whether units are resolved from a local directory instead of a clone
+func (r *RepoConfig) IsLocal() bool {
+	return r.Path != ""
+}
+
+// Source returns the repo URL, or the local path for path-only entries
+func (r *RepoConfig) Source() string {
+	if r.Repo != "" {
+		return r.Repo
+	}
+	return r.Path
 }
 
 // Space represents a ConfigHub space containing units
 type Space struct {
-	Units map[string]*Unit `yaml:"units"`
+	Units    map[string]*Unit `yaml:"units" keys:"slug"`   // units by name
+	UnitSets []*UnitSet       `yaml:"unit-sets,omitempty"` // generators declaring one unit per matched directory or file
+}
+
+// UnitSet declares one unit for each directory or file in the repo that matches a glob.
+// Every generated unit has the settings of the embedded unit, with dir set to the match.
+type UnitSet struct {
+	MatchDirs  string `yaml:"match-dirs,omitempty"`  // glob of directories relative to repo root (e.g., "components/*/production")
+	MatchFiles string `yaml:"match-files,omitempty"` // glob of files relative to repo root; each unit reads its file
+	Name       string `yaml:"name,omitempty"`        // unit name template (e.g., "{{.Dir.Parent}}"), defaults to the dir or file name
+	Unit       `yaml:",inline"`
 }
 
 // Unit represents a config unit with its source definition
 type Unit struct {
-	Dir    string            `yaml:"dir"`              // directory relative to repo root
-	Cmd    string            `yaml:"cmd,omitempty"`    // command to execute (e.g., "kubectl kustomize .")
-	Files  []string          `yaml:"files,omitempty"`  // files to read (alternative to cmd)
-	Labels map[string]string `yaml:"labels,omitempty"` // labels for this unit
+	Dir            string            `yaml:"dir"`                                  // directory relative to repo root
+	Cmd            Command           `yaml:"cmd,omitempty"`                        // command to execute (e.g., "kubectl kustomize .") or list of steps
+	Shell          bool              `yaml:"shell,omitempty"`                      // run each command step via sh -c
+	Files          []string          `yaml:"files,omitempty"`                      // files or glob patterns (e.g., "**/*.yaml") to read (alternative to cmd)
+	Exclude        []string          `yaml:"exclude,omitempty"`                    // glob patterns of files to leave out of files
+	Labels         map[string]string `yaml:"labels,omitempty" keys:"label"`        // labels for this unit
+	Toolchain      string            `yaml:"toolchain,omitempty" enum:"toolchain"` // toolchain type (e.g., "Kubernetes/YAML"), overrides the repo default
+	Env            map[string]string `yaml:"env,omitempty"`                        // environment variables for cmd, override the repo env
+	EnvPassthrough []string          `yaml:"env-passthrough,omitempty"`            // parent environment variables passed to cmd, added to the repo list
+	Timeout        time.Duration     `yaml:"timeout,omitempty"`                    // maximum run time for cmd (e.g., "30s"), overrides the repo default
+	Source         string            `yaml:"-"`                                    // file and line of the unit or its unit-set, set by LoadConfig
+}
+
+// Command is a unit command: either a single command line or a list of steps
+// run in order, where each step's stdout is passed to the next step's stdin
+type Command []string
+
+// UnmarshalYAML accepts either a string or a list of strings
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*c = Command{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var steps []string
+		if err := node.Decode(&steps); err != nil {
+			return err
+		}
+		*c = steps
+		return nil
+	default:
+		return fmt.Errorf("line %d: cmd must be a string or a list of strings", node.Line)
+	}
+}
+
+// MarshalYAML writes a single-step command as a plain string
+func (c Command) MarshalYAML() (any, error) {
+	if len(c) == 1 {
+		return c[0], nil
+	}
+	return []string(c), nil
+}
+
+// String returns the command steps joined as a pipeline
+func (c Command) String() string {
+	return strings.Join(c, " | ")
 }
 
 // ResolvedSpace contains the resolved data for a space
@@ -38,10 +128,12 @@ type ResolvedSpace struct {
 // ResolvedUnit contains the resolved data for a unit
 type ResolvedUnit struct {
 	RepoURL   string
-	SpaceName string            // full space name (with prefix applied)
+	Commit    string // git commit SHA the unit was resolved from
+	SpaceName string // full space name (with prefix applied)
 	UnitName  string
 	Dir       string
 	Cmd       string
 	Labels    map[string]string // merged labels (project + common + repo + unit)
+	Toolchain string            // toolchain type (unit, repo default, or Kubernetes/YAML)
 	Content   []byte            // resolved config content after cmd execution or file read
 }
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultTokenUsername is accepted by GitHub for token auth; other hosts may need a username
+	defaultTokenUsername = "x-access-token"
+
+	// tokenHelper answers git credential requests from environment variables, so the
+	// token never appears in command-line arguments or the repository config
+	tokenHelper = `!f() { test "$1" = get || exit 0; echo "username=$CUB_COMPOSE_GIT_USERNAME"; echo "password=$CUB_COMPOSE_GIT_TOKEN"; }; f`
+)
+
+// Auth holds credentials applied to the git invocations of a single repository
+type Auth struct {
+	SSHKeyPath       string // SSH private key
+	KnownHostsPath   string // known_hosts file; enables strict host key checking
+	Username         string // username for token auth
+	Token            string // HTTPS access token
+	CredentialHelper string // git credential helper command
+}
+
+// env returns environment variables that apply the credentials to a git command run with
+// the inherited environment. Git settings are passed with GIT_CONFIG_* variables rather than
+// arguments so nothing secret is visible in process listings or written to .git/config;
+// they are numbered after any GIT_CONFIG_* entries already inherited, which are kept.
+func (a *Auth) env(inherited []string) []string {
+	// Never fall back to an interactive prompt
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if a == nil {
+		return env
+	}
+
+	if a.SSHKeyPath != "" || a.KnownHostsPath != "" {
+		ssh := []string{"ssh"}
+		if a.SSHKeyPath != "" {
+			ssh = append(ssh, "-i", shellQuote(a.SSHKeyPath), "-o", "IdentitiesOnly=yes")
+		}
+		if a.KnownHostsPath != "" {
+			ssh = append(ssh, "-o", shellQuote("UserKnownHostsFile="+a.KnownHostsPath), "-o", "StrictHostKeyChecking=yes")
+		}
+		env = append(env, "GIT_SSH_COMMAND="+strings.Join(ssh, " "))
+	}
+
+	var config [][2]string
+	switch {
+	case a.CredentialHelper != "":
+		// An empty value clears helpers inherited from the user's git config
+		config = append(config, [2]string{"credential.helper", ""}, [2]string{"credential.helper", a.CredentialHelper})
+	case a.Token != "":
+		username := a.Username
+		if username == "" {
+			username = defaultTokenUsername
+		}
+		config = append(config, [2]string{"credential.helper", ""}, [2]string{"credential.helper", tokenHelper})
+		env = append(env, "CUB_COMPOSE_GIT_USERNAME="+username, "CUB_COMPOSE_GIT_TOKEN="+a.Token)
+	}
+
+	if len(config) > 0 {
+		offset := inheritedConfigCount(inherited)
+		env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", offset+len(config)))
+		for i, kv := range config {
+			n := offset + i
+			env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, kv[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, kv[1]))
+		}
+	}
+
+	return env
+}
+
+// inheritedConfigCount returns the GIT_CONFIG_COUNT set in env, or 0 if it is unset or invalid
+func inheritedConfigCount(env []string) int {
+	count := 0
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "GIT_CONFIG_COUNT="); ok {
+			// The last entry wins, as it does for exec.Cmd.Env
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				n = 0
+			}
+			count = n
+		}
+	}
+	return count
+}
+
+// shellQuote quotes a value for use in GIT_SSH_COMMAND, which git runs through a shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// metadataFile is written inside each checkout's .git directory, where checkouts never touch it
+const metadataFile = "cub-compose.json"
+
+// CacheEntry describes a cached checkout
+type CacheEntry struct {
+	Path     string    `json:"-"`
+	URL      string    `json:"url"`
+	Ref      string    `json:"ref,omitempty"`
+	Commit   string    `json:"commit"`
+	LastUsed time.Time `json:"lastUsed"`
+	Size     int64     `json:"-"`
+}
+
+// CacheDir returns the directory holding cached checkouts
+func (m *Manager) CacheDir() string {
+	return m.cacheDir
+}
+
+// touch records the repository, ref and commit of a checkout and marks it as used now
+func (m *Manager) touch(repoPath, repoURL, ref, commit string) error {
+	entry := CacheEntry{URL: repoURL, Ref: ref, Commit: commit, LastUsed: time.Now().UTC()}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cache metadata: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoPath, ".git", metadataFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache metadata for %s: %w", repoPath, err)
+	}
+	return nil
+}
+
+// cacheNamePattern matches the directory names of checkouts, as made by getRepoPath
+var cacheNamePattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// CacheSkip is a path in the cache directory that isn't a cub-compose checkout
+type CacheSkip struct {
+	Path   string
+	Reason string
+}
+
+// ListCache returns the cached checkouts sorted by URL and ref, and the other paths in the
+// cache directory. Only directories named like a checkout that contain .git and the
+// cub-compose metadata are checkouts; anything else is skipped and never removed.
+// Checkouts made by older versions get their metadata the next time they are used.
+func (m *Manager) ListCache() ([]CacheEntry, []CacheSkip, error) {
+	dirEntries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var entries []CacheEntry
+	var skipped []CacheSkip
+	for _, d := range dirEntries {
+		path := filepath.Join(m.cacheDir, d.Name())
+		entry, err := readCacheEntry(path)
+		if err != nil {
+			skipped = append(skipped, CacheSkip{Path: path, Reason: err.Error()})
+			continue
+		}
+
+		entry.Size, err = dirSize(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to measure %s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].URL != entries[j].URL {
+			return entries[i].URL < entries[j].URL
+		}
+		if entries[i].Ref != entries[j].Ref {
+			return entries[i].Ref < entries[j].Ref
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, skipped, nil
+}
+
+// readCacheEntry reads the metadata of the checkout at path, or returns why path isn't one
+func readCacheEntry(path string) (CacheEntry, error) {
+	var entry CacheEntry
+	if !cacheNamePattern.MatchString(filepath.Base(path)) {
+		return entry, fmt.Errorf("not a cub-compose checkout name")
+	}
+	if info, err := os.Lstat(filepath.Join(path, ".git")); err != nil || !info.IsDir() {
+		return entry, fmt.Errorf("no .git directory")
+	}
+	data, err := os.ReadFile(filepath.Join(path, ".git", metadataFile))
+	if err != nil {
+		return entry, fmt.Errorf("no cub-compose metadata")
+	}
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL == "" {
+		return entry, fmt.Errorf("invalid cub-compose metadata")
+	}
+	entry.Path = path
+	return entry, nil
+}
+
+// RemoveCache deletes a cached checkout, after checking again that it is one
+func (m *Manager) RemoveCache(entry CacheEntry) error {
+	if filepath.Dir(entry.Path) != filepath.Clean(m.cacheDir) {
+		return fmt.Errorf("%s is not in the cache directory %s", entry.Path, m.cacheDir)
+	}
+	if _, err := readCacheEntry(entry.Path); err != nil {
+		return fmt.Errorf("refusing to remove %s: %w", entry.Path, err)
+	}
+	if err := os.RemoveAll(entry.Path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
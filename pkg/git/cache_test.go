@@ -0,0 +1,117 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestListCache(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkout := m.getRepoPath("https://example.com/app.git", "main")
+	mkdirs(t, filepath.Join(checkout, ".git"))
+	if err := m.touch(checkout, "https://example.com/app.git", "main", "abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything else in the cache directory must be left alone
+	dir := m.CacheDir()
+	mkdirs(t,
+		filepath.Join(dir, "src", ".git"),                   // not a checkout name
+		filepath.Join(dir, "0123456789abcdef", "docs"),      // no .git
+		filepath.Join(dir, "fedcba9876543210", ".git"),      // no metadata
+		filepath.Join(dir, "00000000000000ff", ".git"),      // invalid metadata
+		filepath.Join(dir, "0123456789ABCDEF", ".git", "x"), // upper case
+	)
+	writeFile(t, filepath.Join(dir, "00000000000000ff", ".git", metadataFile), "{")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "keep me")
+
+	entries, skipped, err := m.ListCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != checkout || entries[0].URL != "https://example.com/app.git" || entries[0].Ref != "main" {
+		t.Fatalf("entries = %+v, want only the checkout", entries)
+	}
+
+	want := map[string]string{
+		"src":              "not a cub-compose checkout name",
+		"0123456789abcdef": "no .git directory",
+		"fedcba9876543210": "no cub-compose metadata",
+		"00000000000000ff": "invalid cub-compose metadata",
+		"0123456789ABCDEF": "not a cub-compose checkout name",
+		"notes.txt":        "not a cub-compose checkout name",
+	}
+	got := make(map[string]string)
+	for _, skip := range skipped {
+		got[filepath.Base(skip.Path)] = skip.Reason
+	}
+	for name, reason := range want {
+		if got[name] != reason {
+			t.Errorf("skipped %s: reason = %q, want %q", name, got[name], reason)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("skipped = %v, want %d paths", got, len(want))
+	}
+
+	// Skipped paths can't be removed, even when asked to
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := m.RemoveCache(CacheEntry{Path: path}); err == nil {
+			t.Errorf("RemoveCache(%s) succeeded, want it refused", name)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+
+	if err := m.RemoveCache(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(checkout); !os.IsNotExist(err) {
+		t.Errorf("checkout still exists after RemoveCache: %v", err)
+	}
+}
+
+func TestRemoveCacheOutsideCacheDir(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(t.TempDir(), "0123456789abcdef")
+	mkdirs(t, filepath.Join(other, ".git"))
+	writeFile(t, filepath.Join(other, ".git", metadataFile), `{"url": "https://example.com/app.git"}`)
+
+	if err := m.RemoveCache(CacheEntry{Path: other}); err == nil {
+		t.Error("RemoveCache succeeded for a checkout outside the cache directory")
+	}
+}
+
+// mkdirs creates directories, failing the test on errors
+func mkdirs(t *testing.T, dirs ...string) {
+	t.Helper()
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeFile writes a test file, failing the test on errors
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
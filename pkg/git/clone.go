@@ -1,31 +1,62 @@
 package git
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 const (
 	defaultCacheDir = ".cub-compose/repos"
+
+	// cacheDirEnv overrides the default cache directory
+	cacheDirEnv = "CUB_COMPOSE_CACHE_DIR"
+)
+
+// UpdatePolicy controls when cached repositories are fetched from their remote
+type UpdatePolicy int
+
+const (
+	// UpdateAlways fetches the requested ref on every run
+	UpdateAlways UpdatePolicy = iota
+	// UpdateMissing uses cached checkouts as-is and only fetches repos that aren't cached
+	UpdateMissing
+	// UpdateNever uses cached checkouts as-is and fails for repos that aren't cached
+	UpdateNever
 )
 
 // Manager handles git repository operations
 type Manager struct {
 	cacheDir string
+
+	// Update controls whether EnsureRepo fetches repositories that are already cached
+	Update UpdatePolicy
+
+	// Output receives the output of git commands (stdout if nil)
+	Output io.Writer
 }
 
-// NewManager creates a new git manager
-func NewManager() (*Manager, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+// NewManager creates a new git manager that caches checkouts in cacheDir.
+// An empty cacheDir means $CUB_COMPOSE_CACHE_DIR, or ~/.cub-compose/repos if that is unset.
+func NewManager(cacheDir string) (*Manager, error) {
+	if cacheDir == "" {
+		cacheDir = os.Getenv(cacheDirEnv)
+	}
+	if cacheDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		cacheDir = filepath.Join(home, defaultCacheDir)
 	}
 
-	cacheDir := filepath.Join(home, defaultCacheDir)
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
@@ -33,89 +64,218 @@ func NewManager() (*Manager, error) {
 	return &Manager{cacheDir: cacheDir}, nil
 }
 
-// EnsureRepo clones or updates a repository and returns its local path
-func (m *Manager) EnsureRepo(repoURL string, ref string) (string, error) {
-	repoPath := m.getRepoPath(repoURL)
+// IsCommitSHA reports whether ref is a full commit SHA (SHA-1 or SHA-256), in either case
+func IsCommitSHA(ref string) bool {
+	if len(ref) != 40 && len(ref) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
 
-	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		// Clone the repository
-		if err := m.clone(repoURL, repoPath); err != nil {
-			return "", err
+// sameCommit reports whether commit, as printed by git in lower case, is the commit SHA ref
+func sameCommit(commit, ref string) bool {
+	return strings.EqualFold(commit, ref)
+}
+
+// looksAbbreviated reports whether ref could be an abbreviated commit SHA. It may just as
+// well be a tag or branch such as 20240101, so it is only used to explain failed fetches.
+func looksAbbreviated(ref string) bool {
+	return len(ref) >= 7 && !IsCommitSHA(ref) && strings.Trim(strings.ToLower(ref), "0123456789abcdef") == ""
+}
+
+// EnsureRepo fetches ref (a branch, tag or full commit SHA; empty means the remote's
+// default branch) and checks it out. It returns the local path and the resolved commit SHA.
+// auth (may be nil) is applied to the network operations of this repository only.
+// Unless Update is UpdateAlways, a cached checkout is used without contacting the remote.
+func (m *Manager) EnsureRepo(ctx context.Context, repoURL string, ref string, auth *Auth) (string, string, error) {
+	repoPath := m.getRepoPath(repoURL, ref)
+
+	if m.Update != UpdateAlways {
+		commit, err := m.cachedCommit(ctx, repoPath, ref)
+		if err == nil {
+			if err := m.touch(repoPath, repoURL, ref, commit); err != nil {
+				return "", "", err
+			}
+			return repoPath, commit, nil
 		}
-	} else {
-		// Pull latest changes
-		if err := m.pull(repoPath); err != nil {
-			return "", err
+		if m.Update == UpdateNever {
+			return "", "", fmt.Errorf("%s is not available offline: %w", describeRef(repoURL, ref), err)
 		}
 	}
 
-	// Checkout specific ref if provided
-	if ref != "" {
-		if err := m.checkout(repoPath, ref); err != nil {
-			return "", err
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		// Create an empty repository pointing at the remote
+		if err := m.init(ctx, repoURL, repoPath); err != nil {
+			os.RemoveAll(repoPath)
+			return "", "", err
 		}
 	}
 
-	return repoPath, nil
+	// Fetch exactly the requested ref and check it out
+	rev, err := m.fetch(ctx, repoPath, ref, auth)
+	if err != nil {
+		return "", "", err
+	}
+	if err := m.checkout(ctx, repoPath, rev); err != nil {
+		return "", "", err
+	}
+
+	commit, err := m.headCommit(ctx, repoPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	if ref != "" && IsCommitSHA(ref) && !sameCommit(commit, ref) {
+		return "", "", fmt.Errorf("checked out %s in %s, expected %s", commit, repoPath, ref)
+	}
+
+	if err := m.touch(repoPath, repoURL, ref, commit); err != nil {
+		return "", "", err
+	}
+
+	return repoPath, commit, nil
 }
 
-// getRepoPath returns the local path for a repository based on its URL hash
-func (m *Manager) getRepoPath(repoURL string) string {
-	hash := sha256.Sum256([]byte(repoURL))
+// cachedCommit returns the commit checked out in the cached working tree for ref,
+// or an error if the tree was never fetched or doesn't hold the requested commit
+func (m *Manager) cachedCommit(ctx context.Context, repoPath, ref string) (string, error) {
+	if _, err := os.Stat(repoPath); err != nil {
+		return "", fmt.Errorf("not in the repo cache")
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("cached checkout %s has no commit checked out", repoPath)
+	}
+
+	commit := strings.TrimSpace(string(out))
+	if IsCommitSHA(ref) && !sameCommit(commit, ref) {
+		return "", fmt.Errorf("cached checkout %s is at %s, not %s", repoPath, commit, ref)
+	}
+	return commit, nil
+}
+
+// describeRef formats a repository URL with its ref for messages
+func describeRef(repoURL, ref string) string {
+	if ref == "" {
+		return repoURL
+	}
+	return repoURL + "@" + ref
+}
+
+// getRepoPath returns the local path for a repository checkout based on a hash of its URL and ref,
+// so different refs of the same repository get separate working trees
+func (m *Manager) getRepoPath(repoURL, ref string) string {
+	hash := sha256.Sum256([]byte(repoURL + "\x00" + ref))
 	hashStr := hex.EncodeToString(hash[:8]) // use first 8 bytes
 	return filepath.Join(m.cacheDir, hashStr)
 }
 
-// clone clones a repository to the specified path
-func (m *Manager) clone(repoURL, destPath string) error {
-	cmd := exec.Command("git", "clone", "--depth", "1", repoURL, destPath)
+// runGit runs a git command in dir with the given credentials, streaming its output
+func (m *Manager) runGit(ctx context.Context, dir string, auth *Auth, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	environ := os.Environ()
+	cmd.Env = append(environ, auth.env(environ)...)
 	cmd.Stdout = os.Stdout
+	if m.Output != nil {
+		cmd.Stdout = m.Output
+	}
 	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// init creates an empty repository at destPath with the remote as origin
+func (m *Manager) init(ctx context.Context, repoURL, destPath string) error {
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", destPath, err)
+	}
+
+	if err := m.runGit(ctx, destPath, nil, "init", "--quiet"); err != nil {
+		return fmt.Errorf("failed to init repository for %s: %w", repoURL, err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to clone %s: %w", repoURL, err)
+	if err := m.runGit(ctx, destPath, nil, "remote", "add", "origin", repoURL); err != nil {
+		return fmt.Errorf("failed to add remote %s: %w", repoURL, err)
 	}
 
 	return nil
 }
 
-// pull pulls latest changes in a repository
-func (m *Manager) pull(repoPath string) error {
-	cmd := exec.Command("git", "pull", "--ff-only")
-	cmd.Dir = repoPath
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// fetch fetches a single ref from origin and returns the revision to check out.
+// Commit SHAs that the server won't serve directly are found by fetching full history.
+func (m *Manager) fetch(ctx context.Context, repoPath, ref string, auth *Auth) (string, error) {
+	target := ref
+	if target == "" {
+		target = "HEAD"
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to pull in %s: %w", repoPath, err)
+	err := m.runGit(ctx, repoPath, auth, "fetch", "--depth", "1", "origin", target)
+	if err == nil {
+		return "FETCH_HEAD", nil
+	}
+	if !IsCommitSHA(ref) {
+		if looksAbbreviated(ref) {
+			return "", fmt.Errorf("failed to fetch %s in %s (abbreviated commit SHAs can't be fetched; use the full SHA): %w", target, repoPath, err)
+		}
+		return "", fmt.Errorf("failed to fetch %s in %s: %w", target, repoPath, err)
 	}
 
-	return nil
+	// Not every server allows fetching an unadvertised commit; fetch everything instead
+	if err := m.runGit(ctx, repoPath, auth, "fetch", "--unshallow", "--tags", "origin"); err != nil {
+		if err := m.runGit(ctx, repoPath, auth, "fetch", "--tags", "origin"); err != nil {
+			return "", fmt.Errorf("failed to fetch history of %s in %s: %w", ref, repoPath, err)
+		}
+	}
+	return ref, nil
 }
 
-// checkout checks out a specific ref (branch or tag)
-func (m *Manager) checkout(repoPath, ref string) error {
-	// Fetch the ref first
-	fetchCmd := exec.Command("git", "fetch", "origin", ref)
-	fetchCmd.Dir = repoPath
-	fetchCmd.Stdout = os.Stdout
-	fetchCmd.Stderr = os.Stderr
-	_ = fetchCmd.Run() // ignore error, ref might already be available
+// checkout checks out a commit-ish as a detached HEAD, discarding local changes
+func (m *Manager) checkout(ctx context.Context, repoPath, ref string) error {
+	if err := m.runGit(ctx, repoPath, nil, "checkout", "--quiet", "--force", "--detach", ref); err != nil {
+		return fmt.Errorf("failed to checkout %s in %s: %w", ref, repoPath, err)
+	}
 
-	// Checkout the ref
-	cmd := exec.Command("git", "checkout", ref)
+	return nil
+}
+
+// headCommit returns the commit SHA checked out in a repository
+func (m *Manager) headCommit(ctx context.Context, repoPath string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
 	cmd.Dir = repoPath
-	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to checkout %s in %s: %w", ref, repoPath, err)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD in %s: %w", repoPath, err)
 	}
+	return strings.TrimSpace(string(out)), nil
+}
 
-	return nil
+// LocalCommit returns the commit checked out in a local directory, with a "-dirty"
+// suffix if it has uncommitted changes. It returns "" if the directory isn't a git repository.
+func (m *Manager) LocalCommit(ctx context.Context, dir string) string {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+
+	cmd = exec.CommandContext(ctx, "git", "status", "--porcelain")
+	cmd.Dir = dir
+	status, err := cmd.Output()
+	if err == nil && len(bytes.TrimSpace(status)) > 0 {
+		commit += "-dirty"
+	}
+	return commit
 }
 
-// GetRepoPath returns the cached path for a repo URL without any git operations
-func (m *Manager) GetRepoPath(repoURL string) string {
-	return m.getRepoPath(repoURL)
+// GetRepoPath returns the cached path for a repo URL and ref without any git operations
+func (m *Manager) GetRepoPath(repoURL, ref string) string {
+	return m.getRepoPath(repoURL, ref)
 }